@@ -0,0 +1,87 @@
+package ihttp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Authentication types of Options.AuthType.
+const (
+	AuthBasic  = "basic"
+	AuthBearer = "bearer"
+	AuthDigest = "digest"
+
+	// AuthAWSSigV4 signs the requests with AWS Signature Version 4, see
+	// [Options.AWSRegion].
+	AuthAWSSigV4 = "aws-sigv4"
+)
+
+// authTypes are the valid values of Options.AuthType.
+var authTypes = []string{AuthBasic, AuthBearer, AuthDigest, AuthAWSSigV4}
+
+// authType return the authentication type of opts, basic by default.
+func authType(opts Options) string {
+	if opts.AuthType == "" {
+		return AuthBasic
+	}
+	return strings.ToLower(opts.AuthType)
+}
+
+// processAuth complete the credentials of Options.Auth, the password is asked
+// in the terminal if only the user is given, e.g. `-auth alice`. An empty
+// password must be given explicitly as `-auth alice:`. For aws-sigv4 they are
+// the access key and the secret key.
+func (in *Input) processAuth() error {
+	if in.Options.Auth == "" || authType(in.Options) == AuthBearer {
+		return nil
+	}
+	user, _, ok := strings.Cut(in.Options.Auth, SepCredentials)
+	if ok {
+		return nil
+	}
+	prompt := fmt.Sprintf("Password for user %s: ", user)
+	if authType(in.Options) == AuthAWSSigV4 {
+		prompt = fmt.Sprintf("Secret key for %s: ", user)
+	}
+	pass, err := promptPassword(prompt)
+	if err != nil {
+		return err
+	}
+	in.Options.Auth = user + SepCredentials + pass
+	return nil
+}
+
+// buildAuth sets the Authorization header from Options.Auth, unless there is
+// already one from the items, which wins. The Digest authentication is done by
+// the transport instead, since it answers the challenge of the server.
+//
+// Without both, the basic authentication is set with the credentials for the
+// host of the URL in the .netrc file, unless Options.IgnoreNetrc is true or
+// another type is set (aws-sigv4 takes its credentials from elsewhere).
+func (r *request) buildAuth(in *Input) error {
+	if _, ok := r.Header["Authorization"]; ok {
+		return nil
+	}
+	if in.Options.Auth == "" {
+		if in.Options.IgnoreNetrc || authType(in.Options) != AuthBasic {
+			return nil
+		}
+		e, ok, err := lookupNetrc(r.URL.Hostname())
+		if err != nil || !ok {
+			return err
+		}
+		r.SetBasicAuth(e.login, e.password)
+		return nil
+	}
+	switch authType(in.Options) {
+	case AuthBasic:
+		user, pass, _ := strings.Cut(in.Options.Auth, SepCredentials)
+		r.SetBasicAuth(user, pass)
+	case AuthBearer:
+		r.Header.Set("Authorization", "Bearer "+in.Options.Auth)
+	}
+
+	// aws-sigv4 is signed at the end of NewRequest by signAWS.
+
+	return nil
+}
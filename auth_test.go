@@ -0,0 +1,110 @@
+package ihttp
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestBuildAuth(t *testing.T) {
+	setNetrc(t, "")
+	tt := []struct {
+		name  string
+		opts  Options
+		items []item
+		want  []string
+	}{
+		{
+			name: "basic",
+			opts: Options{Auth: "alice:s3cret"},
+			want: []string{"Basic YWxpY2U6czNjcmV0"},
+		},
+		{
+			name: "basic with empty password",
+			opts: Options{Auth: "alice:", AuthType: AuthBasic},
+			want: []string{"Basic YWxpY2U6"},
+		},
+		{
+			name: "bearer",
+			opts: Options{Auth: "eyJhbGciOiJIUzI1NiJ9", AuthType: AuthBearer},
+			want: []string{"Bearer eyJhbGciOiJIUzI1NiJ9"},
+		},
+		{
+			name:  "authorization item wins",
+			opts:  Options{Auth: "alice:s3cret"},
+			items: []item{{Key: "Authorization", Val: "Token abc", Sep: SepHeader}},
+			want:  []string{"Token abc"},
+		},
+		{
+			name:  "empty authorization item wins",
+			opts:  Options{Auth: "alice:s3cret"},
+			items: []item{{Key: "Authorization", Sep: SepHeader}},
+			want:  []string{""},
+		},
+		{
+			name: "no auth",
+			opts: Options{},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			in := &Input{Options: tc.opts, Method: http.MethodGet, URL: "http://example.org", Items: tc.items}
+			req, _, err := NewRequest(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := req.Header.Values("Authorization")
+			if len(got) != len(tc.want) || len(got) > 0 && got[0] != tc.want[0] {
+				t.Errorf("\ngot\t%q\nwant\t%q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestProcessAuth(t *testing.T) {
+	var prompts int
+	promptPassword = func(string) (string, error) {
+		prompts++
+		return "s3cret", nil
+	}
+	defer func() { promptPassword = readPassword }()
+	tt := []struct {
+		name        string
+		opts        Options
+		want        string
+		wantPrompts int
+	}{
+		{
+			name:        "user only",
+			opts:        Options{Auth: "alice"},
+			want:        "alice:s3cret",
+			wantPrompts: 1,
+		},
+		{
+			name: "user and password",
+			opts: Options{Auth: "alice:pass"},
+			want: "alice:pass",
+		},
+		{
+			name: "empty password",
+			opts: Options{Auth: "alice:"},
+			want: "alice:",
+		},
+		{
+			name: "bearer token",
+			opts: Options{Auth: "token", AuthType: AuthBearer},
+			want: "token",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			prompts = 0
+			in := &Input{Options: tc.opts}
+			if err := in.processAuth(); err != nil {
+				t.Fatal(err)
+			}
+			if in.Options.Auth != tc.want || prompts != tc.wantPrompts {
+				t.Errorf("\ngot\t%q, %d prompts\nwant\t%q, %d prompts", in.Options.Auth, prompts, tc.want, tc.wantPrompts)
+			}
+		})
+	}
+}
@@ -3,6 +3,8 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
+	"strings"
 
 	"github.com/adrianolmedo/ihttp"
 )
@@ -24,6 +26,49 @@ type opts struct {
 	Chunked   bool
 	Offline   bool
 	Verbose   bool
+
+	Timeout        string
+	ConnectTimeout string
+	TLSTimeout     string
+	HeaderTimeout  string
+
+	NoFollow      bool
+	MaxRedirects  int
+	FollowTrusted bool
+	All           bool
+
+	Proxy map[string]string
+
+	Verify  string
+	SSL     string
+	Ciphers string
+
+	Cert    string
+	CertKey string
+
+	PrintTLS      bool
+	ExpiryWarning int
+	TLSKeyLog     string
+	Pins          []string
+
+	HTTP11              bool
+	HTTP2               bool
+	HTTP2PriorKnowledge bool
+
+	UnixSocket string
+	Resolve    []string
+	ConnectTo  []string
+
+	AuthType    string
+	AWSRegion   string
+	AWSService  string
+	IgnoreNetrc bool
+
+	Sign           string
+	SignAlg        string
+	SignComponents []string
+	SignKeyID      string
+	ContentDigest  bool
 }
 
 // in only for debug output of Input.
@@ -54,6 +99,49 @@ func (d *dbug) toString() (string, error) {
 			Chunked:   d.opts.Chunked,
 			Offline:   d.opts.Offline,
 			Verbose:   d.opts.Verbose,
+
+			Timeout:        d.opts.Timeout.String(),
+			ConnectTimeout: d.opts.ConnectTimeout.String(),
+			TLSTimeout:     d.opts.TLSTimeout.String(),
+			HeaderTimeout:  d.opts.HeaderTimeout.String(),
+
+			NoFollow:      d.opts.NoFollow,
+			MaxRedirects:  d.opts.MaxRedirects,
+			FollowTrusted: d.opts.FollowTrusted,
+			All:           d.opts.All,
+
+			Proxy: redactProxy(d.opts.Proxy),
+
+			Verify:  d.opts.Verify,
+			SSL:     d.opts.SSL,
+			Ciphers: d.opts.Ciphers,
+
+			Cert:    d.opts.Cert,
+			CertKey: d.opts.CertKey,
+
+			PrintTLS:      d.opts.PrintTLS,
+			ExpiryWarning: d.opts.ExpiryWarning,
+			TLSKeyLog:     d.opts.TLSKeyLog,
+			Pins:          d.opts.Pins,
+
+			HTTP11:              d.opts.HTTP11,
+			HTTP2:               d.opts.HTTP2,
+			HTTP2PriorKnowledge: d.opts.HTTP2PriorKnowledge,
+
+			UnixSocket: d.opts.UnixSocket,
+			Resolve:    d.opts.Resolve,
+			ConnectTo:  d.opts.ConnectTo,
+
+			AuthType:    d.opts.AuthType,
+			AWSRegion:   d.opts.AWSRegion,
+			AWSService:  d.opts.AWSService,
+			IgnoreNetrc: d.opts.IgnoreNetrc,
+
+			Sign:           d.opts.Sign,
+			SignAlg:        d.opts.SignAlg,
+			SignComponents: d.opts.SignComponents,
+			SignKeyID:      d.opts.SignKeyID,
+			ContentDigest:  d.opts.ContentDigest,
 		},
 		in: in{
 			Method:    d.in.Method,
@@ -68,3 +156,30 @@ func (d *dbug) toString() (string, error) {
 	}
 	return string(debugData), nil
 }
+
+// redactProxy return the proxies of p with the passwords of their URLs
+// replaced by xxxxx, so they don't end up in the logs.
+func redactProxy(p map[string]string) map[string]string {
+	if p == nil {
+		return nil
+	}
+	redacted := make(map[string]string, len(p))
+	for scheme, raw := range p {
+		// The scheme of the URL is optional, e.g. `user:pass@proxy:3128`.
+		s := raw
+		if !strings.Contains(s, "://") {
+			s = "http://" + s
+		}
+		u, err := url.Parse(s)
+		if err != nil {
+			redacted[scheme] = "<invalid URL>"
+			continue
+		}
+		s = u.Redacted()
+		if !strings.Contains(raw, "://") {
+			s = strings.TrimPrefix(s, "http://")
+		}
+		redacted[scheme] = s
+	}
+	return redacted
+}
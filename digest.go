@@ -0,0 +1,298 @@
+package ihttp
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// digestAlgorithms maps the algorithms of the Digest authentication (RFC 7616)
+// to their hash functions, from the strongest.
+var digestAlgorithms = []struct {
+	name string
+	hash func() hash.Hash
+}{
+	{"SHA-256", sha256.New},
+	{"SHA-256-sess", sha256.New},
+	{"MD5", md5.New},
+	{"MD5-sess", md5.New},
+}
+
+// challenge is an authentication challenge of a WWW-Authenticate header.
+type challenge struct {
+	scheme string
+	params map[string]string
+}
+
+// digestTransport is a RoundTripper that answers the Digest challenges of the
+// 401 responses by sending the request again with the credentials.
+type digestTransport struct {
+	next     http.RoundTripper
+	user     string
+	password string
+
+	// trusted answers the challenges of any host, otherwise only the ones
+	// of the host of the first request, so the credentials don't follow a
+	// redirect to another host.
+	trusted bool
+	host    string
+
+	// onRetry is called with the 401 response and the request that answers
+	// its challenge, before sending it.
+	onRetry func(*http.Response, *http.Request)
+
+	// cnonce return the client nonce, it's random unless replaced by the
+	// tests.
+	cnonce func() string
+}
+
+func (t *digestTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.host == "" {
+		t.host = req.URL.Host
+	}
+	resp, err := t.next.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	// An explicit Authorization item wins, and the credentials don't follow
+	// a redirect to another host unless it's trusted.
+	if _, ok := req.Header["Authorization"]; ok {
+		return resp, nil
+	}
+	if !t.trusted && !strings.EqualFold(req.URL.Host, t.host) {
+		return resp, nil
+	}
+	c, ok := strongestDigest(parseChallenges(resp.Header.Values("WWW-Authenticate")))
+	if !ok {
+		return resp, nil
+	}
+
+	// The body is sent again, it's the buffered content or a new stream of
+	// the bodyTuple of the request.
+	retry := req.Clone(req.Context())
+	if req.Body != nil && req.Body != http.NoBody {
+		if req.GetBody == nil {
+			return resp, nil
+		}
+		retry.Body, err = req.GetBody()
+		if err != nil {
+			resp.Body.Close()
+			return nil, err
+		}
+	}
+	auth, err := t.authorization(retry, c)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	retry.Header.Set("Authorization", auth)
+	if t.onRetry != nil {
+		t.onRetry(resp, retry)
+	}
+	resp.Body.Close()
+	return t.next.RoundTrip(retry)
+}
+
+// authorization return the value of the Authorization header for req that
+// answers the Digest challenge c.
+func (t *digestTransport) authorization(req *http.Request, c challenge) (string, error) {
+	p := digestParams{
+		algorithm: c.params["algorithm"],
+		user:      t.user,
+		password:  t.password,
+		realm:     c.params["realm"],
+		nonce:     c.params["nonce"],
+		method:    req.Method,
+		uri:       req.URL.RequestURI(),
+		nc:        "00000001",
+		cnonce:    t.cnonce(),
+		userhash:  strings.EqualFold(c.params["userhash"], "true"),
+	}
+	if p.algorithm == "" {
+		p.algorithm = "MD5"
+	}
+	qops := strings.Split(c.params["qop"], ",")
+	for i := range qops {
+		qops[i] = strings.TrimSpace(qops[i])
+	}
+	switch {
+	case slices.Contains(qops, "auth"):
+		p.qop = "auth"
+	case slices.Contains(qops, "auth-int"):
+		p.qop = "auth-int"
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return "", err
+			}
+			defer body.Close()
+			p.body, err = io.ReadAll(body)
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	user := p.user
+	if p.userhash {
+		user = p.hash(p.user + ":" + p.realm)
+	}
+	fields := []string{
+		fmt.Sprintf("username=%q", user),
+		fmt.Sprintf("realm=%q", p.realm),
+		fmt.Sprintf("nonce=%q", p.nonce),
+		fmt.Sprintf("uri=%q", p.uri),
+		"algorithm=" + p.algorithm,
+		fmt.Sprintf("response=%q", p.response()),
+	}
+	if opaque, ok := c.params["opaque"]; ok {
+		fields = append(fields, fmt.Sprintf("opaque=%q", opaque))
+	}
+	if p.qop != "" {
+		fields = append(fields, "qop="+p.qop, "nc="+p.nc, fmt.Sprintf("cnonce=%q", p.cnonce))
+	}
+	if p.userhash {
+		fields = append(fields, "userhash=true")
+	}
+	return "Digest " + strings.Join(fields, ", "), nil
+}
+
+// digestParams are the values to compute the response of a Digest challenge.
+type digestParams struct {
+	algorithm      string
+	user, password string
+	realm, nonce   string
+	method, uri    string
+	qop, nc        string
+	cnonce         string
+	userhash       bool
+
+	// body of the request, only used with the auth-int qop.
+	body []byte
+}
+
+// hash return the hex-encoded hash of s with the algorithm of p.
+func (p digestParams) hash(s string) string {
+	for _, a := range digestAlgorithms {
+		if strings.EqualFold(a.name, p.algorithm) {
+			h := a.hash()
+			io.WriteString(h, s)
+			return hex.EncodeToString(h.Sum(nil))
+		}
+	}
+	return ""
+}
+
+// response return the response of the Digest challenge (RFC 7616 section
+// 3.4.1), or the one of RFC 2069 if there isn't any qop.
+func (p digestParams) response() string {
+	a1 := p.user + ":" + p.realm + ":" + p.password
+	if strings.HasSuffix(strings.ToLower(p.algorithm), "-sess") {
+		a1 = p.hash(a1) + ":" + p.nonce + ":" + p.cnonce
+	}
+	a2 := p.method + ":" + p.uri
+	if p.qop == "auth-int" {
+		a2 += ":" + p.hash(string(p.body))
+	}
+	if p.qop == "" {
+		return p.hash(p.hash(a1) + ":" + p.nonce + ":" + p.hash(a2))
+	}
+	return p.hash(strings.Join([]string{p.hash(a1), p.nonce, p.nc, p.cnonce, p.qop, p.hash(a2)}, ":"))
+}
+
+// newCnonce return a random client nonce.
+func newCnonce() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// strongestDigest return the Digest challenge of cs with the strongest
+// supported algorithm.
+func strongestDigest(cs []challenge) (challenge, bool) {
+	for _, a := range digestAlgorithms {
+		for _, c := range cs {
+			if !strings.EqualFold(c.scheme, "Digest") {
+				continue
+			}
+			alg := c.params["algorithm"]
+			if alg == "" {
+				alg = "MD5"
+			}
+			if strings.EqualFold(alg, a.name) {
+				return c, true
+			}
+		}
+	}
+	return challenge{}, false
+}
+
+// parseChallenges parse the challenges of the values of the WWW-Authenticate
+// headers, e.g. `Digest realm="api", nonce="abc", qop="auth"`. A header value
+// can have several challenges separated by commas.
+func parseChallenges(values []string) []challenge {
+	var cs []challenge
+	for _, v := range values {
+		s := v
+		for {
+			s = strings.TrimLeft(s, " \t,")
+			if s == "" {
+				break
+			}
+			var tok string
+			tok, s = cutToken(s)
+			if tok == "" {
+				break
+			}
+			rest := strings.TrimLeft(s, " \t")
+			if strings.HasPrefix(rest, "=") && len(cs) > 0 {
+				// An auth-param of the current challenge.
+				var val string
+				val, s = cutParamValue(strings.TrimLeft(rest[1:], " \t"))
+				cs[len(cs)-1].params[strings.ToLower(tok)] = val
+				continue
+			}
+			cs = append(cs, challenge{scheme: tok, params: map[string]string{}})
+		}
+	}
+	return cs
+}
+
+// cutToken return the token at the beginning of s and the rest of s.
+func cutToken(s string) (string, string) {
+	i := strings.IndexAny(s, " \t,=\"")
+	if i < 0 {
+		return s, ""
+	}
+	return s[:i], s[i:]
+}
+
+// cutParamValue return the value at the beginning of s, a token or a quoted
+// string, unquoted, and the rest of s.
+func cutParamValue(s string) (string, string) {
+	if !strings.HasPrefix(s, `"`) {
+		return cutToken(s)
+	}
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				b.WriteByte(s[i])
+			}
+		case '"':
+			return b.String(), s[i+1:]
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String(), ""
+}
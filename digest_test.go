@@ -0,0 +1,190 @@
+package ihttp
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// The example of RFC 7616 section 3.9.1.
+var rfc7616Params = digestParams{
+	user:     "Mufasa",
+	password: "Circle of Life",
+	realm:    "http-auth@example.org",
+	nonce:    "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+	method:   http.MethodGet,
+	uri:      "/dir/index.html",
+	qop:      "auth",
+	nc:       "00000001",
+	cnonce:   "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ",
+}
+
+func TestDigestResponse(t *testing.T) {
+	tt := []struct {
+		algorithm string
+		want      string
+	}{
+		{algorithm: "MD5", want: "8ca523f5e9506fed4657c9700eebdbec"},
+		{algorithm: "SHA-256", want: "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.algorithm, func(t *testing.T) {
+			p := rfc7616Params
+			p.algorithm = tc.algorithm
+			if got := p.response(); got != tc.want {
+				t.Errorf("\ngot\t%s\nwant\t%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestParseChallenges(t *testing.T) {
+	values := []string{
+		`Digest realm="http-auth@example.org", qop="auth, auth-int", algorithm=SHA-256, nonce="7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v", opaque="FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"`,
+		`Basic realm="say \"hi\"", Digest realm="http-auth@example.org", algorithm=MD5, nonce="abc"`,
+	}
+	want := []challenge{
+		{scheme: "Digest", params: map[string]string{
+			"realm":     "http-auth@example.org",
+			"qop":       "auth, auth-int",
+			"algorithm": "SHA-256",
+			"nonce":     "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v",
+			"opaque":    "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS",
+		}},
+		{scheme: "Basic", params: map[string]string{"realm": `say "hi"`}},
+		{scheme: "Digest", params: map[string]string{"realm": "http-auth@example.org", "algorithm": "MD5", "nonce": "abc"}},
+	}
+	got := parseChallenges(values)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant\t%#v\ngot\t%#v", want, got)
+	}
+	c, ok := strongestDigest(got)
+	if !ok || c.params["algorithm"] != "SHA-256" {
+		t.Errorf("want the SHA-256 challenge, got %#v", c)
+	}
+}
+
+// newDigestServer return a server that requires the Digest authentication of
+// the user Mufasa with the algorithm alg, and replies with the request body.
+func newDigestServer(t *testing.T, alg string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		cs := parseChallenges([]string{r.Header.Get("Authorization")})
+		if len(cs) != 1 || cs[0].scheme != "Digest" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Digest realm="test", qop="auth", algorithm=%s, nonce="n0nce", opaque="0paque"`, alg))
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, "unauthorized")
+			return
+		}
+		got := cs[0].params
+		p := digestParams{
+			algorithm: alg,
+			user:      "Mufasa",
+			password:  "Circle of Life",
+			realm:     "test",
+			nonce:     "n0nce",
+			method:    r.Method,
+			uri:       r.URL.RequestURI(),
+			qop:       "auth",
+			nc:        got["nc"],
+			cnonce:    got["cnonce"],
+		}
+		if got["response"] != p.response() || got["opaque"] != "0paque" || got["uri"] != r.URL.RequestURI() {
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, "wrong credentials")
+			return
+		}
+		w.Write(body)
+	}))
+}
+
+func TestDigestAuth(t *testing.T) {
+	tt := []struct {
+		name   string
+		alg    string
+		auth   string
+		body   string
+		opts   Options
+		want   string
+		status string
+	}{
+		{
+			name:   "MD5",
+			alg:    "MD5",
+			auth:   "Mufasa:Circle of Life",
+			want:   "HTTP/1.1 200 OK",
+			status: "200 OK",
+		},
+		{
+			name:   "SHA-256 with body",
+			alg:    "SHA-256",
+			auth:   "Mufasa:Circle of Life",
+			body:   `{"foo":"bar"}`,
+			want:   `{"foo":"bar"}`,
+			status: "200 OK",
+		},
+		{
+			name:   "SHA-256-sess",
+			alg:    "SHA-256-sess",
+			auth:   "Mufasa:Circle of Life",
+			status: "200 OK",
+		},
+		{
+			name:   "wrong password",
+			alg:    "MD5",
+			auth:   "Mufasa:nope",
+			want:   "wrong credentials",
+			status: "401 Unauthorized",
+		},
+		{
+			name: "verbose shows both exchanges",
+			alg:  "MD5",
+			auth: "Mufasa:Circle of Life",
+			body: `{"foo":"bar"}`,
+			opts: Options{Verbose: true},
+			want: "POST / HTTP/1.1\n",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newDigestServer(t, tc.alg)
+			defer srv.Close()
+			opts := tc.opts
+			opts.Auth = tc.auth
+			opts.AuthType = AuthDigest
+			method := http.MethodGet
+			if tc.body != "" {
+				method = http.MethodPost
+			}
+			in := &Input{Options: opts, Method: method, URL: srv.URL, StdinData: []byte(tc.body), BodyType: RawBody}
+			if tc.body == "" {
+				in.StdinData, in.BodyType = nil, EmptyBody
+			}
+			req, body, err := NewRequest(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := NewOutput(req, body, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(out.String(), tc.want) {
+				t.Errorf("\ngot\t%q\nwant\t%q", out.String(), tc.want)
+			}
+			if tc.status != "" && !strings.Contains(out.String(), "HTTP/1.1 "+tc.status+"\n") {
+				t.Errorf("want status %q in %q", tc.status, out.String())
+			}
+			if opts.Verbose {
+				n := strings.Count(out.String(), "POST / HTTP/1.1\n")
+				if n != 2 || !strings.Contains(out.String(), "HTTP/1.1 401 Unauthorized\n") || !strings.Contains(out.String(), "Authorization: Digest username=\"Mufasa\"") {
+					t.Errorf("want both exchanges in %q", out.String())
+				}
+			}
+		})
+	}
+}
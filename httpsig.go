@@ -0,0 +1,373 @@
+package ihttp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Algorithms of Options.SignAlg, the names of the HTTP Signature Algorithms
+// registry of RFC 9421.
+const (
+	SignHMACSHA256 = "hmac-sha256"
+	SignEd25519    = "ed25519"
+	SignECDSAP256  = "ecdsa-p256-sha256"
+	SignRSAPSS     = "rsa-pss-sha512"
+)
+
+// signAlgs are the valid values of Options.SignAlg.
+var signAlgs = []string{SignHMACSHA256, SignEd25519, SignECDSAP256, SignRSAPSS}
+
+// signAlgAliases are the short names accepted for Options.SignAlg.
+var signAlgAliases = map[string]string{
+	"ecdsa-p256": SignECDSAP256,
+	"rsa-pss":    SignRSAPSS,
+}
+
+// signLabel is the label of the signature in the Signature-Input and
+// Signature headers.
+const signLabel = "sig1"
+
+// derivedComponents are the supported derived components of RFC 9421.
+var derivedComponents = []string{"@method", "@target-uri", "@authority", "@scheme", "@request-target", "@path", "@query"}
+
+// signAlg return the registry name of the algorithm s, or false if it isn't
+// supported.
+func signAlg(s string) (string, bool) {
+	s = strings.ToLower(s)
+	if alg, ok := signAlgAliases[s]; ok {
+		return alg, true
+	}
+	return s, slices.Contains(signAlgs, s)
+}
+
+// parseComponents validate the components of Options.SignComponents, which
+// are derived components like `@method` or header names.
+func parseComponents(components []string) ([]string, error) {
+	var parsed []string
+	for _, c := range components {
+		c = strings.ToLower(c)
+		if strings.HasPrefix(c, "@") && !slices.Contains(derivedComponents, c) {
+			return nil, fmt.Errorf("unsupported -sign-components %q (expected %s or a header name)", c, strings.Join(derivedComponents, ", "))
+		}
+		if c == "@" || !strings.HasPrefix(c, "@") && !isToken(c) {
+			return nil, fmt.Errorf("invalid -sign-components %q", c)
+		}
+		if slices.Contains(parsed, c) {
+			return nil, fmt.Errorf("duplicated -sign-components %q", c)
+		}
+		parsed = append(parsed, c)
+	}
+	return parsed, nil
+}
+
+// isToken returns true if s is a valid header name.
+func isToken(s string) bool {
+	tok, rest := cutToken(s)
+	return tok != "" && rest == "" && !strings.ContainsAny(s, "()<>@,;:\\\"/[]?={}")
+}
+
+// signComponents return the components to sign of opts, by default @method,
+// @target-uri and content-digest if the request has a body.
+func signComponents(opts Options, hasBody bool) []string {
+	if len(opts.SignComponents) > 0 {
+		components, _ := parseComponents(opts.SignComponents)
+		return components
+	}
+	components := []string{"@method", "@target-uri"}
+	if hasBody {
+		components = append(components, "content-digest")
+	}
+	return components
+}
+
+// buildContentDigest sets the Content-Digest header (RFC 9530) with the
+// SHA-256 of the body if Options.ContentDigest is true or the signature covers
+// it, unless there is already one from the items. A streamed body is hashed
+// from a new stream, so it fails for a body which can only be read once (stdin
+// with -chunked or a pipe).
+func (r *request) buildContentDigest(in *Input, b bodyTuple) error {
+	hasBody := len(b.content) > 0 || b.open != nil
+	signed := in.Options.Sign != "" && slices.Contains(signComponents(in.Options, hasBody), "content-digest")
+	if !in.Options.ContentDigest && !signed {
+		return nil
+	}
+	if _, ok := r.Header["Content-Digest"]; ok {
+		return nil
+	}
+	if b.once {
+		if in.Options.ContentDigest {
+			return errors.New("-content-digest can't be used with a streamed body from stdin or a pipe")
+		}
+		return errors.New("-sign with content-digest can't be used with a streamed body from stdin or a pipe, set -sign-components without it")
+	}
+	sum, err := hashBody(b)
+	if err != nil {
+		return fmt.Errorf("cannot compute the Content-Digest: %w", err)
+	}
+	r.Header.Set("Content-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum)+":")
+	return nil
+}
+
+// buildSignature sets the Signature-Input and Signature headers of the HTTP
+// Message Signature (RFC 9421) of the request, if Options.Sign is set. It must
+// be the last step of [NewRequest], after all the signed components are set.
+func (r *request) buildSignature(in *Input, hasBody bool) error {
+	if in.Options.Sign == "" {
+		return nil
+	}
+	key, err := loadSigningKey(in.Options.Sign, in.Options.SignAlg)
+	if err != nil {
+		return err
+	}
+	params := signParams{
+		components: signComponents(in.Options, hasBody),
+		created:    time.Now(),
+		keyID:      in.Options.SignKeyID,
+	}
+
+	// The algorithm is only declared if it's given, otherwise the verifier
+	// knows it from the key.
+	if in.Options.SignAlg != "" {
+		params.alg = key.alg
+	}
+	return signMessage(r.Request, key, params)
+}
+
+// signParams are the signed components and the parameters of a signature.
+type signParams struct {
+	components []string
+	created    time.Time
+	keyID      string
+	alg        string
+}
+
+// String return the value of the @signature-params component, e.g.
+// `("@method" "@target-uri");created=1618884473;keyid="test-key"`.
+func (p signParams) String() string {
+	quoted := make([]string, len(p.components))
+	for i, c := range p.components {
+		quoted[i] = strconv.Quote(c)
+	}
+	s := "(" + strings.Join(quoted, " ") + ");created=" + strconv.FormatInt(p.created.Unix(), 10)
+	if p.keyID != "" {
+		s += ";keyid=" + strconv.Quote(p.keyID)
+	}
+	if p.alg != "" {
+		s += ";alg=" + strconv.Quote(p.alg)
+	}
+	return s
+}
+
+// signMessage sets the Signature-Input and Signature headers of req signed
+// with key over the components of params.
+func signMessage(req *http.Request, key signingKey, params signParams) error {
+	base, err := signatureBase(req, params)
+	if err != nil {
+		return err
+	}
+	sig, err := key.sign(base)
+	if err != nil {
+		return fmt.Errorf("cannot sign the request: %w", err)
+	}
+	req.Header.Set("Signature-Input", signLabel+"="+params.String())
+	req.Header.Set("Signature", signLabel+"=:"+base64.StdEncoding.EncodeToString(sig)+":")
+	return nil
+}
+
+// signatureBase return the signature base of req (RFC 9421 section 2.5), a
+// line for each component and the @signature-params at the end.
+func signatureBase(req *http.Request, params signParams) ([]byte, error) {
+	var b bytes.Buffer
+	for _, c := range params.components {
+		v, err := componentValue(req, c)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&b, "%q: %s\n", c, v)
+	}
+	fmt.Fprintf(&b, "%q: %s", "@signature-params", params)
+	return b.Bytes(), nil
+}
+
+// componentValue return the value of the component c of req.
+func componentValue(req *http.Request, c string) (string, error) {
+	switch c {
+	case "@method":
+		return req.Method, nil
+	case "@target-uri":
+		u := *req.URL
+		u.User = nil
+		return u.String(), nil
+	case "@authority":
+		return authority(req), nil
+	case "@scheme":
+		return strings.ToLower(req.URL.Scheme), nil
+	case "@request-target":
+		return req.URL.RequestURI(), nil
+	case "@path":
+		if p := req.URL.EscapedPath(); p != "" {
+			return p, nil
+		}
+		return "/", nil
+	case "@query":
+		return "?" + req.URL.RawQuery, nil
+	}
+	vs := req.Header.Values(c)
+	if len(vs) == 0 && c == "content-length" && req.ContentLength >= 0 && req.Body != nil && req.Body != http.NoBody {
+		vs = []string{strconv.FormatInt(req.ContentLength, 10)}
+	}
+	if len(vs) == 0 {
+		return "", fmt.Errorf("cannot sign the %q header, the request doesn't have it", c)
+	}
+	for i, v := range vs {
+		vs[i] = strings.TrimSpace(v)
+	}
+	return strings.Join(vs, ", "), nil
+}
+
+// authority return the host of req in lowercase, without the default port of
+// its scheme.
+func authority(req *http.Request) string {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	host = strings.ToLower(host)
+	switch {
+	case req.URL.Scheme == "http" && strings.HasSuffix(host, ":80"):
+		return strings.TrimSuffix(host, ":80")
+	case req.URL.Scheme == "https" && strings.HasSuffix(host, ":443"):
+		return strings.TrimSuffix(host, ":443")
+	}
+	return host
+}
+
+// signingKey is the key of an HTTP Message Signature algorithm: the shared
+// secret for hmac-sha256, or an ed25519.PrivateKey, *ecdsa.PrivateKey or
+// *rsa.PrivateKey.
+type signingKey struct {
+	alg string
+	key any
+}
+
+// loadSigningKey load the key of the file at path for the algorithm alg. The
+// file is a PEM private key, or the shared secret for hmac-sha256 (without the
+// trailing newlines). If alg is empty it's the one of the PEM key, or
+// hmac-sha256 if the file isn't a PEM key. An encrypted key is decrypted with
+// the passphrase asked in the terminal.
+func loadSigningKey(path, alg string) (signingKey, error) {
+	path, err := expandHome(path)
+	if err != nil {
+		return signingKey{}, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("cannot read the signing key (-sign): %w", err)
+	}
+	if alg != "" {
+		alg, _ = signAlg(alg)
+	}
+	block := findKeyBlock(b)
+	if alg == SignHMACSHA256 || alg == "" && block == nil {
+		secret := bytes.TrimRight(b, "\r\n")
+		if len(secret) == 0 {
+			return signingKey{}, fmt.Errorf("the shared secret of %q is empty", path)
+		}
+		return signingKey{alg: SignHMACSHA256, key: secret}, nil
+	}
+	if block == nil {
+		return signingKey{}, fmt.Errorf("no private key found in %q", path)
+	}
+	if isEncryptedKey(block) {
+		pass, err := promptPassword("Passphrase for the signing key: ")
+		if err != nil {
+			return signingKey{}, err
+		}
+		block, err = decryptKey(block, pass)
+		if err != nil {
+			return signingKey{}, err
+		}
+	}
+	key, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		return signingKey{}, fmt.Errorf("invalid signing key %q: %w", path, err)
+	}
+	var keyAlg string
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		keyAlg = SignEd25519
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return signingKey{}, fmt.Errorf("unsupported signing key %q: the ECDSA curve must be P-256", path)
+		}
+		keyAlg = SignECDSAP256
+	case *rsa.PrivateKey:
+		keyAlg = SignRSAPSS
+	default:
+		return signingKey{}, fmt.Errorf("unsupported signing key %q: %T", path, key)
+	}
+	if alg != "" && alg != keyAlg {
+		return signingKey{}, fmt.Errorf("the signing key %q is for %s, not %s", path, keyAlg, alg)
+	}
+	return signingKey{alg: keyAlg, key: key}, nil
+}
+
+// parsePrivateKey parse a DER private key in the PKCS #8, PKCS #1 or SEC 1
+// format.
+func parsePrivateKey(der []byte) (crypto.PrivateKey, error) {
+	if key, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(der); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("unknown private key format")
+}
+
+// sign return the signature of the signature base with the key.
+func (k signingKey) sign(base []byte) ([]byte, error) {
+	switch key := k.key.(type) {
+	case []byte:
+		h := hmac.New(sha256.New, key)
+		h.Write(base)
+		return h.Sum(nil), nil
+	case ed25519.PrivateKey:
+		return ed25519.Sign(key, base), nil
+	case *ecdsa.PrivateKey:
+		// The signature is r and s concatenated, not ASN.1.
+		digest := sha256.Sum256(base)
+		r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		sig := make([]byte, 64)
+		r.FillBytes(sig[:32])
+		s.FillBytes(sig[32:])
+		return sig, nil
+	case *rsa.PrivateKey:
+		digest := sha512.Sum512(base)
+		return rsa.SignPSS(rand.Reader, key, crypto.SHA512, digest[:], &rsa.PSSOptions{SaltLength: sha512.Size})
+	}
+	return nil, fmt.Errorf("unsupported key %T", k.key)
+}
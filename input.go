@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"os"
 	"regexp"
 	"strings"
@@ -49,6 +50,10 @@ type Input struct {
 	Items     []item
 	StdinData []byte
 	BodyType  BodyType
+
+	// stdin is the unread stdin when it's streamed with -chunked, in which
+	// case StdinData is nil.
+	stdin io.Reader
 }
 
 // NewInput return an Input pointer after parsing args o stdin value
@@ -104,7 +109,21 @@ func NewInput(args []string, opts Options) (*Input, error) {
 	}
 
 	// Set URL.
-	in.processURL(url)
+	err = in.processURL(url)
+	if err != nil {
+		return nil, err
+	}
+
+	// Validate again, an http+unix URL sets the socket.
+	if err := in.Options.IsValid(); err != nil {
+		return nil, err
+	}
+
+	// Complete the credentials of -auth.
+	err = in.processAuth()
+	if err != nil {
+		return nil, err
+	}
 	return &in, nil
 }
 
@@ -124,19 +143,47 @@ func (in *Input) processItems(items []string) error {
 	}
 
 	// Validate separator rules that depend on options.
+	var bodyFiles int
 	for _, it := range in.Items {
-		if it.Sep == SepFileUpload && !in.Options.Form && !in.Options.Multipart {
+		if it.Sep != SepFileUpload || in.Options.Form || in.Options.Multipart {
+			continue
+		}
+
+		// A key-less file item (`@data.txt`) is the raw request body.
+		if it.Key != "" {
 			return fmt.Errorf("invalid file fields (perhaps you meant -form?): %s", it.Key)
 		}
+		bodyFiles++
+	}
+	if bodyFiles > 1 {
+		return errors.New("can't read request body from multiple files")
 	}
 	return nil
 }
 
+// bodyFile return the key-less file item (`@data.txt`) used as raw request body,
+// it's only considered as such without -form or -multipart.
+func (in *Input) bodyFile() (item, bool) {
+	if in.Options.Form || in.Options.Multipart {
+		return item{}, false
+	}
+	for _, it := range in.Items {
+		if it.Sep == SepFileUpload && it.Key == "" {
+			return it, true
+		}
+	}
+	return item{}, false
+}
+
 // processBodyType set BodyType value by the priority of options flags
 // and items separators.
 func (in *Input) processBodyType() {
 	// 1. Priority based on options flags
-	if in.Options.Raw != "" || in.StdinData != nil {
+	if in.Options.Raw != "" || in.StdinData != nil || in.stdin != nil {
+		in.BodyType = RawBody
+		return
+	}
+	if _, ok := in.bodyFile(); ok {
 		in.BodyType = RawBody
 		return
 	}
@@ -159,9 +206,9 @@ func (in *Input) processBodyType() {
 	var hasJSON, hasData bool
 	for _, it := range in.Items {
 		switch it.Sep {
-		case SepDataRawJSON:
+		case SepDataRawJSON, SepDataEmbedRawJSONFile:
 			hasJSON = true
-		case SepDataString:
+		case SepDataString, SepDataEmbedFileContents:
 			hasData = true
 		}
 	}
@@ -181,7 +228,7 @@ func (in *Input) processBodyType() {
 }
 
 // processStdin read the stdin data if exists. Also check that only one of
-// the data sources is used: items, -raw or stdin.
+// the data sources is used: items, -raw, a body file (`@data.txt`) or stdin.
 func (in *Input) processStdin(stdin io.Reader) error {
 	stat, err := os.Stdin.Stat()
 	if err != nil {
@@ -198,6 +245,24 @@ func (in *Input) processStdin(stdin io.Reader) error {
 		in.StdinData = []byte(in.Options.Raw)
 		return nil
 	}
+	if it, ok := in.bodyFile(); ok {
+
+		// With -chunked the file is opened and streamed by [NewRequest].
+		if in.Options.Chunked {
+			return nil
+		}
+		f, err := openBodyFile(it)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in.StdinData, err = io.ReadAll(f)
+		return err
+	}
+	if hasStdin && in.Options.Chunked {
+		in.stdin = stdin
+		return nil
+	}
 	if hasStdin {
 		in.StdinData, err = io.ReadAll(stdin)
 		if err != nil {
@@ -207,11 +272,30 @@ func (in *Input) processStdin(stdin io.Reader) error {
 	return nil
 }
 
+// openBodyFile open the file of the key-less file item it used as raw request
+// body.
+func openBodyFile(it item) (*os.File, error) {
+	fu := parseFileUpload(it.Val)
+	path, err := expandHome(fu.Path)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file %q: %w", fu.Path, err)
+	}
+	return f, nil
+}
+
 // ensureOneDataSource it can only be one source of input request data.
 func ensureOneDataSource(items []item, opts Options, hasStdin bool) error {
-	var hasDataItems bool
+	var hasDataItems, hasFile bool
 	dataSeps := SepsGroupDataItems()
 	for _, it := range items {
+		if it.Sep == SepFileUpload && it.Key == "" && !opts.Form && !opts.Multipart {
+			hasFile = true
+			continue
+		}
 		for _, sep := range dataSeps {
 			if it.Sep == sep {
 				hasDataItems = true
@@ -233,6 +317,9 @@ func ensureOneDataSource(items []item, opts Options, hasStdin bool) error {
 	if hasStdin {
 		count++
 	}
+	if hasFile {
+		count++
+	}
 	if count > 1 {
 		return errors.New("request body (stdin, -raw, or file) and request data items (key=value, key:=value) cannot be mixed")
 	}
@@ -262,8 +349,20 @@ func guessMethod(bodyType BodyType) string {
 }
 
 // processURL set URL value, works as parseURL in httpie-go.
-func (in *Input) processURL(url string) {
+// An `http+unix://` URL is turned into an `http://localhost` one, and the
+// socket path of its host is set as Options.UnixSocket.
+func (in *Input) processURL(url string) error {
+	if rest, ok := strings.CutPrefix(url, "http+unix://"); ok {
+		host, path, _ := strings.Cut(rest, "/")
+		socket, err := neturl.PathUnescape(host)
+		if err != nil || socket == "" {
+			return fmt.Errorf("invalid URL %q: the host must be the percent-encoded path of a socket, e.g. http+unix://%%2Fvar%%2Frun%%2Fdocker.sock/info", url)
+		}
+		in.Options.UnixSocket = socket
+		url = "http://localhost/" + path
+	}
 	in.URL = processURL(url, in.Options.Scheme())
+	return nil
 }
 
 func processURL(url, scheme string) string {
@@ -2,6 +2,7 @@ package ihttp
 
 import (
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -79,6 +80,63 @@ func TestProcessURL(t *testing.T) {
 	}
 }
 
+func TestProcessUnixURL(t *testing.T) {
+	tt := []struct {
+		name        string
+		url         string
+		want        string
+		wantSocket  string
+		errExpected bool
+	}{
+		{
+			name:       "socket and path",
+			url:        "http+unix://%2Fvar%2Frun%2Fdocker.sock/containers/json?all=1",
+			want:       "http://localhost/containers/json?all=1",
+			wantSocket: "/var/run/docker.sock",
+		},
+		{
+			name:       "socket only",
+			url:        "http+unix://%2Ftmp%2Fadmin.sock",
+			want:       "http://localhost/",
+			wantSocket: "/tmp/admin.sock",
+		},
+		{
+			name:        "missing socket",
+			url:         "http+unix:///info",
+			errExpected: true,
+		},
+		{
+			name:        "invalid escape",
+			url:         "http+unix://%zz/info",
+			errExpected: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			in := &Input{}
+			err := in.processURL(tc.url)
+			if (err != nil) != tc.errExpected {
+				t.Fatalf("%s: unexpected error status: %v", tc.name, err)
+			}
+			if tc.errExpected {
+				return
+			}
+			if in.URL != tc.want || in.Options.UnixSocket != tc.wantSocket {
+				t.Errorf("\ngot\t%q %q\nwant\t%q %q", in.URL, in.Options.UnixSocket, tc.want, tc.wantSocket)
+			}
+		})
+	}
+}
+
+func TestNewInputUnixURLWithProxy(t *testing.T) {
+	opts := Options{Proxy: map[string]string{"http": "http://proxy:3128"}}
+	_, err := NewInput([]string{"http+unix://%2Fvar%2Frun%2Fdocker.sock/info"}, opts)
+	want := "can't be used with -proxy"
+	if err == nil || !strings.Contains(err.Error(), want) {
+		t.Fatalf("\ngot\t%v\nwant\t%#q", err, want)
+	}
+}
+
 func TestProcessURLWithHTTPS(t *testing.T) {
 	tt := []struct {
 		name   string
@@ -149,6 +207,29 @@ func TestProcessItems(t *testing.T) {
 			args:        []string{"localhost", "query==value"},
 			errExpected: true,
 		},
+		{
+			name: "@file",
+			args: []string{"@examples/plain.txt"},
+			want: []item{
+				{
+					Key:  "",
+					Val:  "examples/plain.txt",
+					Sep:  "@",
+					Orig: "@examples/plain.txt",
+				},
+			},
+			errExpected: false,
+		},
+		{
+			name:        "field@file without -form",
+			args:        []string{"file@examples/plain.txt"},
+			errExpected: true,
+		},
+		{
+			name:        "multiple @file",
+			args:        []string{"@examples/plain.txt", "@examples/data.json"},
+			errExpected: true,
+		},
 	}
 	in := &Input{}
 	for _, tc := range tt {
@@ -164,3 +245,48 @@ func TestProcessItems(t *testing.T) {
 		})
 	}
 }
+
+func TestEnsureOneDataSource(t *testing.T) {
+	tt := []struct {
+		name        string
+		items       []item
+		opts        Options
+		hasStdin    bool
+		errExpected bool
+	}{
+		{
+			name:  "@file",
+			items: []item{{Val: "data.txt", Sep: SepFileUpload}},
+		},
+		{
+			name:        "@file foo=bar",
+			items:       []item{{Val: "data.txt", Sep: SepFileUpload}, {Key: "foo", Val: "bar", Sep: SepDataString}},
+			errExpected: true,
+		},
+		{
+			name:        "@file with stdin",
+			items:       []item{{Val: "data.txt", Sep: SepFileUpload}},
+			hasStdin:    true,
+			errExpected: true,
+		},
+		{
+			name:        "@file with -raw",
+			items:       []item{{Val: "data.txt", Sep: SepFileUpload}},
+			opts:        Options{Raw: "data"},
+			errExpected: true,
+		},
+		{
+			name:  "-form @file foo=bar",
+			items: []item{{Val: "data.txt", Sep: SepFileUpload}, {Key: "foo", Val: "bar", Sep: SepDataString}},
+			opts:  Options{Form: true},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ensureOneDataSource(tc.items, tc.opts, tc.hasStdin)
+			if (err != nil) != tc.errExpected {
+				t.Fatalf("%s: unexpected error status: %v", tc.name, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package ihttp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// netrcEntry are the credentials of a machine in a .netrc file.
+type netrcEntry struct {
+	machine  string
+	login    string
+	password string
+}
+
+// netrcPath return the path of the .netrc file, the NETRC environment variable
+// or ~/.netrc.
+func netrcPath() (string, error) {
+	if p := os.Getenv("NETRC"); p != "" {
+		return expandHome(p)
+	}
+	return expandHome("~/.netrc")
+}
+
+// lookupNetrc return the credentials for host from the .netrc file, or the
+// default ones of the file. It returns false if the file doesn't exist or
+// there aren't credentials for host.
+func lookupNetrc(host string) (netrcEntry, bool, error) {
+	path, err := netrcPath()
+	if err != nil {
+		return netrcEntry{}, false, err
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return netrcEntry{}, false, nil
+	}
+	if err != nil {
+		return netrcEntry{}, false, fmt.Errorf("cannot read the .netrc file: %w", err)
+	}
+	var def netrcEntry
+	var hasDef bool
+	for _, e := range parseNetrc(string(b)) {
+		if e.machine == "" {
+			if !hasDef {
+				def, hasDef = e, true
+			}
+			continue
+		}
+		if strings.EqualFold(e.machine, host) {
+			return e, true, nil
+		}
+	}
+	return def, hasDef, nil
+}
+
+// parseNetrc parse the entries of the content s of a .netrc file. The default
+// entry has an empty machine, and the macros (macdef) are skipped.
+func parseNetrc(s string) []netrcEntry {
+	var entries []netrcEntry
+	toks := netrcTokens(s)
+	for i := 0; i < len(toks); i++ {
+		var val string
+		if i+1 < len(toks) {
+			val = toks[i+1]
+		}
+		switch toks[i] {
+		case "machine":
+			entries = append(entries, netrcEntry{machine: val})
+			i++
+		case "default":
+			entries = append(entries, netrcEntry{})
+		case "login", "password", "account":
+			if len(entries) > 0 {
+				e := &entries[len(entries)-1]
+				switch toks[i] {
+				case "login":
+					e.login = val
+				case "password":
+					e.password = val
+				}
+			}
+			i++
+		}
+	}
+	return entries
+}
+
+// netrcTokens return the tokens of the content s of a .netrc file, without the
+// comments and the macro definitions, which end with an empty line.
+func netrcTokens(s string) []string {
+	var toks []string
+	var inMacro bool
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		line := sc.Text()
+		if inMacro {
+			inMacro = strings.TrimSpace(line) != ""
+			continue
+		}
+		for _, f := range strings.Fields(line) {
+			if strings.HasPrefix(f, "#") {
+				break
+			}
+			if f == "macdef" {
+				inMacro = true
+				break
+			}
+			toks = append(toks, f)
+		}
+	}
+	return toks
+}
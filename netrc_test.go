@@ -0,0 +1,120 @@
+package ihttp
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const netrcTest = `# CI credentials
+machine api.example.com login ci password s3cret
+machine
+    git.example.com
+    login deploy
+    password t0ken
+
+macdef init
+machine ignored.example.com login nope password nope
+
+default login anonymous password guest
+`
+
+func TestParseNetrc(t *testing.T) {
+	want := []netrcEntry{
+		{machine: "api.example.com", login: "ci", password: "s3cret"},
+		{machine: "git.example.com", login: "deploy", password: "t0ken"},
+		{login: "anonymous", password: "guest"},
+	}
+	got := parseNetrc(netrcTest)
+	if !reflect.DeepEqual(want, got) {
+		t.Errorf("\nwant\t%#v\ngot\t%#v", want, got)
+	}
+}
+
+// setNetrc write content to a .netrc file in a temporary directory and set
+// the NETRC environment variable to its path.
+func setNetrc(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), ".netrc")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("NETRC", path)
+}
+
+func TestNetrcAuth(t *testing.T) {
+	tt := []struct {
+		name    string
+		netrc   string
+		url     string
+		opts    Options
+		items   []item
+		want    string
+		wantSet bool
+	}{
+		{
+			name:    "machine",
+			netrc:   netrcTest,
+			url:     "https://api.example.com/v1",
+			want:    "Basic Y2k6czNjcmV0",
+			wantSet: true,
+		},
+		{
+			name:    "machine with port",
+			netrc:   netrcTest,
+			url:     "https://git.example.com:8443",
+			want:    "Basic ZGVwbG95OnQwa2Vu",
+			wantSet: true,
+		},
+		{
+			name:    "default",
+			netrc:   netrcTest,
+			url:     "https://other.example.com",
+			want:    "Basic YW5vbnltb3VzOmd1ZXN0",
+			wantSet: true,
+		},
+		{
+			name:  "no default",
+			netrc: "machine api.example.com login ci password s3cret\n",
+			url:   "https://other.example.com",
+		},
+		{
+			name:  "ignore netrc",
+			netrc: netrcTest,
+			url:   "https://api.example.com",
+			opts:  Options{IgnoreNetrc: true},
+		},
+		{
+			name:    "auth wins",
+			netrc:   netrcTest,
+			url:     "https://api.example.com",
+			opts:    Options{Auth: "alice:pass"},
+			want:    "Basic YWxpY2U6cGFzcw==",
+			wantSet: true,
+		},
+		{
+			name:    "authorization item wins",
+			netrc:   netrcTest,
+			url:     "https://api.example.com",
+			items:   []item{{Key: "Authorization", Val: "Token abc", Sep: SepHeader}},
+			want:    "Token abc",
+			wantSet: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			setNetrc(t, tc.netrc)
+			in := &Input{Options: tc.opts, Method: http.MethodGet, URL: tc.url, Items: tc.items}
+			req, _, err := NewRequest(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, ok := req.Header["Authorization"]
+			if ok != tc.wantSet || ok && got[0] != tc.want {
+				t.Errorf("\ngot\t%q\nwant\t%q", got, tc.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,12 @@
 package ihttp
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
 
 // Options represent the flags.
 type Options struct {
@@ -13,6 +19,158 @@ type Options struct {
 	Offline   bool
 	Verbose   bool
 	scheme    string
+
+	// Timeout limits the whole exchange, including reading the response
+	// body. Zero means no timeout, the CLI sets 30s unless -timeout is given.
+	Timeout time.Duration
+
+	// ConnectTimeout limits the establishment of the TCP connection. Zero
+	// means 30s, in the CLI too.
+	ConnectTimeout time.Duration
+
+	// TLSTimeout limits the TLS handshake. Zero means 10s, in the CLI too.
+	TLSTimeout time.Duration
+
+	// HeaderTimeout limits the wait for the response headers after the
+	// request is fully written. Zero means no limit other than Timeout, in
+	// the CLI too.
+	HeaderTimeout time.Duration
+
+	// NoFollow disables following the redirects, the redirect response is
+	// the final one.
+	NoFollow bool
+
+	// MaxRedirects is the number of redirects to follow before failing, zero
+	// fails at the first redirect. The CLI sets DefaultMaxRedirects unless
+	// -max-redirects is given.
+	MaxRedirects int
+
+	// FollowTrusted keeps the sensitive headers (Authorization, Cookie, etc.)
+	// when a redirect goes to another host.
+	FollowTrusted bool
+
+	// All prints the intermediate responses of the redirects too.
+	All bool
+
+	// Proxy maps a URL scheme (http or https) to the URL of the proxy used
+	// for the requests with that scheme. The schemes without a proxy use the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables.
+	Proxy map[string]string
+
+	// Verify is `yes` (or empty) to verify the certificate of the server with
+	// the system CAs, `no` to skip the verification, or the path of a PEM
+	// file with the CA certificates to verify it with.
+	Verify string
+
+	// SSL is the minimum TLS version: tls1, tls1.1, tls1.2 or tls1.3.
+	SSL string
+
+	// Ciphers is the list of the allowed cipher suites for TLS 1.2 and
+	// earlier, separated by commas or colons.
+	Ciphers string
+
+	// Cert is the path of the PEM file with the client certificate for
+	// mutual TLS. The file can have the private key too.
+	Cert string
+
+	// CertKey is the path of the PEM file with the private key of Cert, if
+	// it isn't in the same file.
+	CertKey string
+
+	// CertKeyPass is the passphrase of an encrypted private key, it's asked
+	// in the terminal if it's empty.
+	CertKeyPass string
+
+	// PrintTLS prints the TLS version, cipher suite and ALPN protocol of the
+	// connection and the certificate chain of the server before the response.
+	PrintTLS bool
+
+	// ExpiryWarning is the number of days before the expiry of a certificate
+	// of the server to warn about it with PrintTLS, zero disables it.
+	ExpiryWarning int
+
+	// TLSKeyLog is the path of a file where the TLS secrets are appended in
+	// the NSS key log format, to decrypt captures of the traffic, e.g. with
+	// Wireshark. Anyone with the file can decrypt the traffic.
+	TLSKeyLog string
+
+	// Pins are the SHA-256 hashes of the public keys (SPKI) that a
+	// certificate of the verified chain of the server must have, or its leaf
+	// if the verification is skipped, in the form `sha256//<base64 hash>`.
+	// The request fails with a [PinError] if none of them matches.
+	Pins []string
+
+	// HTTP11 forces HTTP/1.1, HTTP/2 isn't used even if the server supports
+	// it.
+	HTTP11 bool
+
+	// HTTP2 forces HTTP/2 over TLS, the request fails if the server doesn't
+	// support it.
+	HTTP2 bool
+
+	// HTTP2PriorKnowledge forces HTTP/2, also without TLS (h2c) by starting
+	// the connection with HTTP/2 directly instead of upgrading it.
+	HTTP2PriorKnowledge bool
+
+	// UnixSocket is the path of a Unix domain socket to connect to instead
+	// of the host of the URL, which is still used for the Host header. It's
+	// also set by [NewInput] from an `http+unix://` URL.
+	UnixSocket string
+
+	// Resolve sets the addresses of a host and port, like the --resolve
+	// option of curl, in the form `HOST:PORT:ADDR[,ADDR]...`. The Host header
+	// and the TLS server name are still the host of the URL.
+	Resolve []string
+
+	// ConnectTo rewrites the host and port to connect to, like the
+	// --connect-to option of curl, in the form `HOST1:PORT1:HOST2:PORT2`.
+	// An empty HOST1 or PORT1 matches any, and an empty HOST2 or PORT2 keeps
+	// the original one.
+	ConnectTo []string
+
+	// Auth are the credentials, `user:pass` for the basic authentication,
+	// the token for the bearer one or `ACCESS_KEY:SECRET` for aws-sigv4. If
+	// the password is missing it's asked in the terminal by [NewInput].
+	Auth string
+
+	// AuthType is the authentication scheme of Auth: basic (the default),
+	// bearer, digest or aws-sigv4.
+	AuthType string
+
+	// AWSRegion and AWSService are the region and the service the requests
+	// are signed for with the aws-sigv4 AuthType, e.g. `us-east-1` and `s3`.
+	// They are taken from the host of the URL if it's an amazonaws.com one.
+	// Without Auth, the credentials are the ones of the AWS_ACCESS_KEY_ID,
+	// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables or
+	// of the AWS_PROFILE profile in ~/.aws/credentials.
+	AWSRegion  string
+	AWSService string
+
+	// IgnoreNetrc disables the credentials of the .netrc file, used when
+	// there is neither Auth nor an Authorization header item.
+	IgnoreNetrc bool
+
+	// Sign is the key file to sign the requests with HTTP Message Signatures
+	// (RFC 9421): a PEM private key, or the shared secret for hmac-sha256.
+	Sign string
+
+	// SignAlg is the algorithm of the signature: hmac-sha256, ed25519,
+	// ecdsa-p256-sha256 or rsa-pss-sha512 (or their short names ecdsa-p256
+	// and rsa-pss). By default it's the one of the PEM key, or hmac-sha256
+	// for a shared secret, and it isn't declared in the alg parameter.
+	SignAlg string
+
+	// SignComponents are the signed components, derived ones like `@method`,
+	// `@target-uri` or `@path`, and header names like `content-digest`. By
+	// default @method, @target-uri and content-digest if there is a body.
+	SignComponents []string
+
+	// SignKeyID is the keyid parameter of the signature.
+	SignKeyID string
+
+	// ContentDigest adds a Content-Digest header (RFC 9530) with the SHA-256
+	// of the body. It's also added when the signature covers content-digest.
+	ContentDigest bool
 }
 
 // Scheme return the value of the scheme unexported field by defalut will return
@@ -35,5 +193,65 @@ func (o *Options) IsValid() error {
 	if o.Boundary != "" && !o.Multipart {
 		return errors.New("-boundary requires -multipart")
 	}
+	if o.Timeout < 0 || o.ConnectTimeout < 0 || o.TLSTimeout < 0 || o.HeaderTimeout < 0 {
+		return errors.New("timeouts must not be negative")
+	}
+	if o.MaxRedirects < 0 {
+		return errors.New("-max-redirects must not be negative")
+	}
+	if o.SSL != "" {
+		if _, err := parseTLSVersion(o.SSL); err != nil {
+			return err
+		}
+	}
+	if o.Ciphers != "" {
+		if _, err := parseCipherSuites(o.Ciphers); err != nil {
+			return err
+		}
+	}
+	if o.HTTP11 && (o.HTTP2 || o.HTTP2PriorKnowledge) || o.HTTP2 && o.HTTP2PriorKnowledge {
+		return errors.New("-http1.1, -http2 and -http2-prior-knowledge are mutually exclusive")
+	}
+	if o.ExpiryWarning < 0 {
+		return errors.New("-expiry-warning must not be negative")
+	}
+	if o.CertKey != "" && o.Cert == "" {
+		return errors.New("-cert-key requires -cert")
+	}
+	if _, err := parsePins(o.Pins); err != nil {
+		return err
+	}
+	if o.AuthType != "" && !slices.Contains(authTypes, strings.ToLower(o.AuthType)) {
+		return fmt.Errorf("invalid -auth-type %q (expected %s)", o.AuthType, strings.Join(authTypes, ", "))
+	}
+	if o.AuthType != "" && o.Auth == "" && authType(*o) != AuthAWSSigV4 {
+		return errors.New("-auth-type requires -auth")
+	}
+	if (o.AWSRegion != "" || o.AWSService != "") && authType(*o) != AuthAWSSigV4 {
+		return errors.New("-aws-region and -aws-service require -auth-type aws-sigv4")
+	}
+	if (o.SignAlg != "" || len(o.SignComponents) > 0 || o.SignKeyID != "") && o.Sign == "" {
+		return errors.New("-sign-alg, -sign-components and -sign-key-id require -sign")
+	}
+	if _, ok := signAlg(o.SignAlg); o.SignAlg != "" && !ok {
+		return fmt.Errorf("invalid -sign-alg %q (expected %s)", o.SignAlg, strings.Join(signAlgs, ", "))
+	}
+	if _, err := parseComponents(o.SignComponents); err != nil {
+		return err
+	}
+	if _, err := newAddrRewriter(o.Resolve, o.ConnectTo); err != nil {
+		return err
+	}
+	if o.UnixSocket != "" && len(o.Proxy) > 0 {
+		return errors.New("-unix-socket (or an http+unix URL) can't be used with -proxy")
+	}
+	for scheme, u := range o.Proxy {
+		if scheme != "http" && scheme != "https" {
+			return fmt.Errorf("invalid -proxy protocol %q (expected http or https)", scheme)
+		}
+		if _, err := parseProxyURL(u); err != nil {
+			return err
+		}
+	}
 	return nil
 }
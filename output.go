@@ -2,9 +2,15 @@ package ihttp
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"net/http/httptrace"
 	"sort"
 	"strings"
 	"time"
@@ -19,6 +25,10 @@ type Output struct {
 	Options     Options
 	requestBody []byte // snapshot before send
 
+	// pendingRequest writes a request once its connection is ready, so that
+	// the request line has the protocol negotiated on it.
+	pendingRequest func(proto string)
+
 	sb  strings.Builder
 	err error
 }
@@ -26,10 +36,12 @@ type Output struct {
 // NewOutput return a new Output.
 func NewOutput(req *http.Request, body []byte, opts Options) (*Output, error) {
 	o := &Output{Request: req, Options: opts, requestBody: body}
-	if o.Options.Verbose || o.Options.Offline {
-		o.writeRequest()
-	}
-	if !o.Options.Offline {
+	if o.Options.Offline {
+		o.writeRequest(expectedProto(req, opts))
+	} else {
+		if o.Options.Verbose {
+			o.pendingRequest = o.writeRequest
+		}
 		o.writeResponse()
 	}
 	if o.err != nil {
@@ -39,9 +51,16 @@ func NewOutput(req *http.Request, body []byte, opts Options) (*Output, error) {
 }
 
 // withErr filters the contents of the Output render through the supplied
-// function, which returns an error, which will be set on Output.
+// function, which returns an error, which will be set on Output. The function
+// isn't called if Output already has an error, and a nil error doesn't clear
+// the one set by a nested call.
 func (o *Output) withErr(filter func() error) {
-	o.err = filter()
+	if o.err != nil {
+		return
+	}
+	if err := filter(); err != nil {
+		o.err = err
+	}
 }
 
 // writeHeaders write Headers from h.
@@ -64,24 +83,13 @@ func sortHeaderKeys(h http.Header) []string {
 	return keys
 }
 
-// writeRequest write the HTTP Request from Request parsed.
-func (o *Output) writeRequest() {
+// writeRequest write the HTTP Request from Request parsed, sent with the
+// protocol proto.
+func (o *Output) writeRequest(proto string) {
 	o.withErr(func() error {
 		req := o.Request
+		o.writeRequestHead(req, proto)
 
-		// Request line
-		o.sb.WriteString(req.Method + " " + req.URL.RequestURI() + " " + req.Proto + "\n")
-
-		// Host header — prefer req.Host (user override), fall back to URL host
-		host := req.Host
-		if host == "" {
-			host = req.URL.Host
-		}
-		o.sb.WriteString("Host: " + host + "\n")
-		// Remaining headers (sorted, skip Host since we wrote it manually)
-		headers := req.Header.Clone()
-		headers.Del("Host")
-		o.writeHeaders(headers)
 		// Body
 		if req.Body != nil && req.Body != http.NoBody {
 			o.writeRequestBody(req)
@@ -91,20 +99,65 @@ func (o *Output) writeRequest() {
 	})
 }
 
+// writePendingRequest write the pending request, if any, with the protocol
+// proto of its connection.
+func (o *Output) writePendingRequest(proto string) {
+	if o.pendingRequest == nil {
+		return
+	}
+	write := o.pendingRequest
+	o.pendingRequest = nil
+	write(proto)
+}
+
+// writeRequestHead write the request line, with the protocol proto, and the
+// headers of req.
+func (o *Output) writeRequestHead(req *http.Request, proto string) {
+	// Request line
+	o.sb.WriteString(req.Method + " " + req.URL.RequestURI() + " " + proto + "\n")
+
+	// Host header — prefer req.Host (user override), fall back to URL host
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	o.sb.WriteString("Host: " + host + "\n")
+	// Remaining headers (sorted, skip Host since we wrote it manually)
+	headers := req.Header.Clone()
+	headers.Del("Host")
+	if len(req.TransferEncoding) > 0 {
+		headers.Set("Transfer-Encoding", strings.Join(req.TransferEncoding, ", "))
+	}
+	o.writeHeaders(headers)
+}
+
 // writeRequestBody write the Body from r.
 func (o *Output) writeRequestBody(r *http.Request) {
 	o.withErr(func() error {
-		if len(o.requestBody) == 0 {
+		body := o.requestBody
+
+		// A multipart body has a preview without the content of the files.
+		// Other streamed bodies (-chunked, or with a pipe) have no snapshot,
+		// they're only shown with -offline since the request won't be sent.
+		if len(body) == 0 && o.Options.Offline {
+			var err error
+			body, err = io.ReadAll(r.Body)
+			if err != nil {
+				return err
+			}
+		}
+		if len(body) == 0 {
+			o.sb.WriteString("\n<streamed body>\n")
 			return nil
 		}
-		if isJSON(bytes.NewReader(o.requestBody)) {
+		if isJSON(bytes.NewReader(body)) {
 			var buf bytes.Buffer
-			if err := json.Indent(&buf, o.requestBody, "", TabSpaces); err != nil {
+			if err := json.Indent(&buf, body, "", TabSpaces); err != nil {
 				return err
 			}
 			o.sb.WriteString("\n" + buf.String() + "\n")
 		} else {
-			o.sb.WriteString("\n" + string(o.requestBody) + "\n")
+			o.sb.WriteString("\n" + string(body) + "\n")
 		}
 		return nil
 	})
@@ -128,10 +181,23 @@ func isJSON(r io.Reader) bool {
 // to string.
 func (o *Output) writeResponse() {
 	o.withErr(func() error {
-		r, err := newResponse(o.Request)
+		var hooks clientHooks
+		if o.Options.All {
+			hooks.onRedirect = o.writeIntermediate
+		}
+		if o.Options.Verbose {
+			hooks.onProxyConnect = o.writeProxyConnect
+			hooks.onClientCert = o.writeClientCert
+			hooks.onConn = o.writePendingRequest
+			hooks.onAuthRetry = o.writeIntermediate
+		}
+		r, err := newResponse(o.Request, o.Options, hooks)
 		if err != nil {
 			return err
 		}
+		if o.Options.PrintTLS && r.TLS != nil {
+			o.writeTLS(r.TLS)
+		}
 		o.sb.WriteString(r.Proto + " " + r.Status + "\n")
 		o.writeHeaders(r.Header)
 		o.writeResponseBody(r)
@@ -139,12 +205,148 @@ func (o *Output) writeResponse() {
 	})
 }
 
-// newResponse helper that returns a *http.Response given a *http.Request.
-func newResponse(req *http.Request) (*http.Response, error) {
-	client := &http.Client{
-		Timeout: time.Second * 30,
+// writeIntermediate write the intermediate response r of a redirect or of an
+// authentication challenge, followed by the head of the next request if
+// Options.Verbose is true.
+func (o *Output) writeIntermediate(r *http.Response, next *http.Request) {
+	o.withErr(func() error {
+		o.sb.WriteString(r.Proto + " " + r.Status + "\n")
+		o.writeHeaders(r.Header)
+		o.writeResponseBody(r)
+		o.sb.WriteString("\n\n")
+		if o.Options.Verbose {
+			o.pendingRequest = func(proto string) {
+				o.writeRequestHead(next, proto)
+				o.sb.WriteString("\n")
+			}
+		}
+		return nil
+	})
+}
+
+// writeProxyConnect write the CONNECT request sent to a proxy to open a tunnel
+// and the head of the response of the proxy.
+func (o *Output) writeProxyConnect(req *http.Request, r *http.Response) {
+	o.withErr(func() error {
+		o.sb.WriteString(req.Method + " " + req.Host + " HTTP/1.1\n")
+		o.sb.WriteString("Host: " + req.Host + "\n")
+		o.writeHeaders(req.Header)
+		o.sb.WriteString("\n")
+		o.sb.WriteString(r.Proto + " " + r.Status + "\n")
+		o.writeHeaders(r.Header)
+		o.sb.WriteString("\n")
+		return nil
+	})
+}
+
+// writeClientCert write the client certificate c sent to the server.
+func (o *Output) writeClientCert(c *x509.Certificate) {
+	o.withErr(func() error {
+		o.sb.WriteString("Client certificate:\n")
+		o.writeCertificate(c)
+		o.sb.WriteString("\n")
+		return nil
+	})
+}
+
+// writeTLS write the state of the TLS connection cs and the certificate chain
+// of the server, followed by a warning for each certificate that expires within
+// Options.ExpiryWarning days.
+func (o *Output) writeTLS(cs *tls.ConnectionState) {
+	alpn := cs.NegotiatedProtocol
+	if alpn == "" {
+		alpn = "none"
+	}
+	o.sb.WriteString("TLS connection:\n")
+	o.sb.WriteString(TabSpaces + "Version: " + tls.VersionName(cs.Version) + "\n")
+	o.sb.WriteString(TabSpaces + "Cipher suite: " + tls.CipherSuiteName(cs.CipherSuite) + "\n")
+	o.sb.WriteString(TabSpaces + "ALPN protocol: " + alpn + "\n")
+	o.sb.WriteString(TabSpaces + "Server name: " + cs.ServerName + "\n")
+	for i, c := range cs.PeerCertificates {
+		o.sb.WriteString(fmt.Sprintf("Certificate %d/%d:\n", i+1, len(cs.PeerCertificates)))
+		o.writeCertificate(c)
+	}
+	if o.Options.ExpiryWarning > 0 {
+		limit := time.Duration(o.Options.ExpiryWarning) * 24 * time.Hour
+		for i, c := range cs.PeerCertificates {
+			left := time.Until(c.NotAfter)
+			if left >= limit {
+				continue
+			}
+			days := int(left.Hours() / 24)
+			when := fmt.Sprintf("expires in %d days", days)
+			if left < 0 {
+				when = fmt.Sprintf("expired %d days ago", -days)
+			}
+			o.sb.WriteString(fmt.Sprintf("Warning: certificate %d (%s) %s, on %s\n", i+1, c.Subject, when, c.NotAfter.UTC().Format(time.RFC3339)))
+		}
 	}
-	return client.Do(req)
+	o.sb.WriteString("\n")
+}
+
+// writeCertificate write the main fields of the certificate c, indented.
+func (o *Output) writeCertificate(c *x509.Certificate) {
+	sum := sha256.Sum256(c.Raw)
+	fingerprint := make([]string, len(sum))
+	for i, b := range sum {
+		fingerprint[i] = fmt.Sprintf("%02X", b)
+	}
+	o.sb.WriteString(TabSpaces + "Subject: " + c.Subject.String() + "\n")
+	if sans := subjectAltNames(c); len(sans) > 0 {
+		o.sb.WriteString(TabSpaces + "SANs: " + strings.Join(sans, ", ") + "\n")
+	}
+	o.sb.WriteString(TabSpaces + "Issuer: " + c.Issuer.String() + "\n")
+	o.sb.WriteString(TabSpaces + "Serial: " + c.SerialNumber.String() + "\n")
+	o.sb.WriteString(TabSpaces + "Not before: " + c.NotBefore.UTC().Format(time.RFC3339) + "\n")
+	o.sb.WriteString(TabSpaces + "Not after: " + c.NotAfter.UTC().Format(time.RFC3339) + "\n")
+	o.sb.WriteString(TabSpaces + "SHA-256 fingerprint: " + strings.Join(fingerprint, ":") + "\n")
+}
+
+// subjectAltNames return the subject alternative names of c, prefixed by their
+// type like in OpenSSL, e.g. `DNS:example.org` or `IP:127.0.0.1`.
+func subjectAltNames(c *x509.Certificate) []string {
+	var sans []string
+	for _, name := range c.DNSNames {
+		sans = append(sans, "DNS:"+name)
+	}
+	for _, ip := range c.IPAddresses {
+		sans = append(sans, "IP:"+ip.String())
+	}
+	for _, email := range c.EmailAddresses {
+		sans = append(sans, "email:"+email)
+	}
+	for _, u := range c.URIs {
+		sans = append(sans, "URI:"+u.String())
+	}
+	return sans
+}
+
+// newResponse helper that returns a *http.Response given a *http.Request, sent
+// with a client configured by opts and hooks.
+func newResponse(req *http.Request, opts Options, hooks clientHooks) (*http.Response, error) {
+	client, err := newClient(opts, hooks)
+	if err != nil {
+		return nil, err
+	}
+	if opts.HTTP2 && req.URL.Scheme != "https" {
+		return nil, errors.New("-http2 requires an https URL, use -http2-prior-knowledge for HTTP/2 without TLS")
+	}
+	p := &phase{name: "connect"}
+	ctx := httptrace.WithClientTrace(req.Context(), p.trace())
+	if hooks.onConn != nil {
+		ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+			GotConn: func(info httptrace.GotConnInfo) {
+				hooks.onConn(connProto(info.Conn, opts))
+			},
+		})
+	}
+	req = req.WithContext(ctx)
+	resp, err := client.Do(req)
+	if err != nil {
+		setPinErrorHost(err)
+		return nil, p.wrapErr(err)
+	}
+	return resp, nil
 }
 
 // writeResponseBody write the Body from r.
@@ -152,6 +354,9 @@ func (o *Output) writeResponseBody(r *http.Response) {
 	o.withErr(func() error {
 		defer r.Body.Close()
 		bodyData, err := io.ReadAll(r.Body)
+		if isTimeout(err) {
+			return fmt.Errorf("timeout during reading the response body: %w", err)
+		}
 		if err != nil {
 			return err
 		}
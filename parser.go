@@ -131,3 +131,61 @@ func tokenize(arg string, seps []string) []token {
 	}
 	return tokens
 }
+
+// fileUpload represent the value of a file upload item, the path of the file
+// on disk with the optional parameters that follow it, for example:
+//
+//	me.png;type=image/png;filename=avatar.png
+type fileUpload struct {
+	// Path of the file on disk.
+	Path string
+
+	// ContentType set with the [SepFileUploadType] parameter, empty if it's
+	// not specified.
+	ContentType string
+
+	// Filename set with the [SepFileUploadFilename] parameter, empty if it's
+	// not specified.
+	Filename string
+}
+
+// parseFileUpload parse the value of a file upload item as [fileUpload]. The
+// parameters can come in any order, and the content type may contain
+// semicolons of its own, e.g. `doc.txt;type=text/plain; charset=utf-8`.
+func parseFileUpload(val string) fileUpload {
+	params := []string{SepFileUploadType, SepFileUploadFilename}
+
+	// nextParam return the position of the nearest parameter in s, or the
+	// length of s if there isn't any.
+	nextParam := func(s string) int {
+		pos := len(s)
+		for _, p := range params {
+			if i := strings.Index(s, p); i != -1 && i < pos {
+				pos = i
+			}
+		}
+		return pos
+	}
+	i := nextParam(val)
+	fu := fileUpload{Path: val[:i]}
+	rest := val[i:]
+	for rest != "" {
+		var param string
+		for _, p := range params {
+			if strings.HasPrefix(rest, p) {
+				param = p
+				break
+			}
+		}
+		rest = rest[len(param):]
+		end := nextParam(rest)
+		switch param {
+		case SepFileUploadType:
+			fu.ContentType = rest[:end]
+		case SepFileUploadFilename:
+			fu.Filename = rest[:end]
+		}
+		rest = rest[end:]
+	}
+	return fu
+}
@@ -147,6 +147,28 @@ func TestParseItem(t *testing.T) {
 			},
 			errExpected: false,
 		},
+		{
+			name: "embed file contents",
+			arg:  "body=@note.md",
+			want: item{
+				Key:  "body",
+				Val:  "note.md",
+				Sep:  "=@",
+				Orig: "body=@note.md",
+			},
+			errExpected: false,
+		},
+		{
+			name: "embed raw JSON file",
+			arg:  "items[]:=@line.json",
+			want: item{
+				Key:  "items[]",
+				Val:  "line.json",
+				Sep:  ":=@",
+				Orig: "items[]:=@line.json",
+			},
+			errExpected: false,
+		},
 	}
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
@@ -167,3 +189,55 @@ func BenchmarkParseItem(b *testing.B) {
 		parseItem(argBench, sepsTest)
 	}
 }
+
+func TestParseFileUpload(t *testing.T) {
+	tt := []struct {
+		name string
+		val  string
+		want fileUpload
+	}{
+		{
+			name: "path only",
+			val:  "me.png",
+			want: fileUpload{Path: "me.png"},
+		},
+		{
+			name: "type",
+			val:  "me.png;type=image/png",
+			want: fileUpload{Path: "me.png", ContentType: "image/png"},
+		},
+		{
+			name: "filename",
+			val:  "me.png;filename=avatar.png",
+			want: fileUpload{Path: "me.png", Filename: "avatar.png"},
+		},
+		{
+			name: "type and filename",
+			val:  "me.png;type=image/png;filename=avatar.png",
+			want: fileUpload{Path: "me.png", ContentType: "image/png", Filename: "avatar.png"},
+		},
+		{
+			name: "filename and type",
+			val:  "me.png;filename=avatar.png;type=image/png",
+			want: fileUpload{Path: "me.png", ContentType: "image/png", Filename: "avatar.png"},
+		},
+		{
+			name: "type with parameters",
+			val:  "doc.txt;type=text/plain; charset=utf-8",
+			want: fileUpload{Path: "doc.txt", ContentType: "text/plain; charset=utf-8"},
+		},
+		{
+			name: "semicolon in path",
+			val:  "a;b.txt",
+			want: fileUpload{Path: "a;b.txt"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got := parseFileUpload(tc.val)
+			if !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("%s\nwant\t%#v\ngot\t%#v", tc.val, tc.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package ihttp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+)
+
+// promptPassword ask for a secret (a passphrase or a password) in the
+// terminal, it's a variable so that the tests can replace it.
+var promptPassword = readPassword
+
+// readPassword print prompt to the terminal and read a line from it without
+// echoing the typed characters. The terminal is used instead of stdin, which
+// may have the request body. If the echo can't be disabled (e.g. there isn't
+// an stty command) it fails instead of showing the secret.
+func readPassword(prompt string) (string, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return "", errors.New("cannot prompt for the secret: no terminal available")
+	}
+	defer tty.Close()
+	if err := stty(tty, "-echo"); err != nil {
+		return "", fmt.Errorf("cannot prompt for the secret: cannot disable the echo of the terminal: %w", err)
+	}
+
+	// Restore the echo even if the prompt is interrupted.
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		if _, ok := <-sig; ok {
+			stty(tty, "echo")
+			fmt.Fprintln(tty)
+			os.Exit(130)
+		}
+	}()
+	defer func() {
+		signal.Stop(sig)
+		close(sig)
+		stty(tty, "echo")
+		fmt.Fprintln(tty)
+	}()
+	fmt.Fprint(tty, prompt)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && line == "" {
+		return "", fmt.Errorf("cannot read the secret: %w", err)
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// stty run the stty command with args on the terminal tty.
+func stty(tty *os.File, args ...string) error {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	return cmd.Run()
+}
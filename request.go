@@ -2,16 +2,22 @@ package ihttp
 
 import (
 	"bytes"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"mime/multipart"
 	"net/http"
+	"net/textproto"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"unicode/utf8"
 )
 
 type request struct {
@@ -19,19 +25,45 @@ type request struct {
 }
 
 // NewRequest builds and start process to return HTTP Request from [Input] values.
-func NewRequest(in *Input) (*http.Request, []byte, error) {
+// It also return the body to print, which is a preview for a streamed multipart
+// body and nil for other streamed bodies.
+func NewRequest(in *Input) (_ *http.Request, _ []byte, retErr error) {
 	b, err := buildBody(in)
 	if err != nil {
 		return nil, nil, err
 	}
 	var bodyReader io.Reader = http.NoBody
-	if len(b.content) > 0 {
+	switch {
+	case b.open != nil:
+		rc, err := b.open()
+		if err != nil {
+			return nil, nil, err
+		}
+		bodyReader = rc
+
+		// The stream isn't sent if a later step fails.
+		defer func() {
+			if retErr != nil {
+				rc.Close()
+			}
+		}()
+	case len(b.content) > 0:
 		bodyReader = bytes.NewBuffer(b.content)
 	}
 	req, err := http.NewRequest(in.Method, in.URL, bodyReader)
 	if err != nil {
 		return nil, nil, err
 	}
+	if b.open != nil {
+		req.GetBody = b.open
+		req.ContentLength = b.size
+	}
+
+	// An unknown length makes the transport send the body in chunks.
+	if in.Options.Chunked && bodyReader != http.NoBody {
+		req.ContentLength = -1
+		req.TransferEncoding = []string{"chunked"}
+	}
 	if req.Header.Get("Content-Type") == "" && b.contentType != "" {
 		req.Header.Set("Content-Type", b.contentType)
 	}
@@ -40,19 +72,60 @@ func NewRequest(in *Input) (*http.Request, []byte, error) {
 	if err != nil {
 		return nil, nil, err
 	}
+
+	// After the headers, so an explicit Authorization item wins.
+	err = r.buildAuth(in)
+	if err != nil {
+		return nil, nil, err
+	}
 	r.buildDefaultHeaders(in)
 	err = r.buildURLQuery(in)
 	if err != nil {
 		return nil, nil, err
 	}
+
+	err = r.buildContentDigest(in, b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// After the query and all the headers, which are signed.
+	err = r.signAWS(in, b)
+	if err != nil {
+		return nil, nil, err
+	}
+	err = r.buildSignature(in, len(b.content) > 0 || b.open != nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if b.preview != nil {
+		return r.Request, b.preview, nil
+	}
 	return r.Request, b.content, nil
 }
 
 // bodyTuple is a simple struct to hold the content and content type of the
-// request body.
+// request body. The body is either buffered in content or produced lazily as a
+// stream by open.
 type bodyTuple struct {
 	content     []byte
 	contentType string
+
+	// open return a new reader of the body each time it's called, so the body
+	// can be sent again (e.g. after a redirect), unless once is true.
+	open func() (io.ReadCloser, error)
+
+	// once is true if the body can only be read once, when it comes from
+	// stdin or from a file that isn't regular (e.g. a named pipe). Then open
+	// fails after the first call.
+	once bool
+
+	// size is the length of the stream returned by open, -1 if unknown.
+	size int64
+
+	// preview is printed in place of a streamed multipart body, with a
+	// placeholder for the content of each file.
+	preview []byte
 }
 
 // buildBody builds the body content and content type based on the [BodyType]
@@ -63,10 +136,55 @@ func buildBody(in *Input) (bodyTuple, error) {
 		return bodyTuple{}, nil
 
 	case RawBody:
-		return bodyTuple{
+		contentType := "application/json"
+
+		// Take the Content-Type of the body file from its type parameter or
+		// guess it from its extension, e.g. `@data.xml`.
+		if it, ok := in.bodyFile(); ok {
+			fu := parseFileUpload(it.Val)
+			if fu.ContentType != "" {
+				contentType = fu.ContentType
+			} else if t := mime.TypeByExtension(filepath.Ext(fu.Path)); t != "" {
+				contentType = t
+			}
+		}
+		b := bodyTuple{
 			content:     in.StdinData,
-			contentType: "application/json",
-		}, nil
+			contentType: contentType,
+		}
+
+		// With -chunked, stdin and the body file aren't read in advance.
+		if in.Options.Chunked {
+			b.size = -1
+			if in.stdin != nil {
+				b.open = openOnce(func() (io.ReadCloser, error) {
+					return io.NopCloser(in.stdin), nil
+				})
+				b.once = true
+			}
+			if it, ok := in.bodyFile(); ok {
+				b.open = func() (io.ReadCloser, error) {
+					return openBodyFile(it)
+				}
+				regular, err := isRegularFile(parseFileUpload(it.Val).Path)
+				if err != nil {
+					return bodyTuple{}, err
+				}
+
+				// Fail early if the file cannot be opened, unless it
+				// can only be read once.
+				if !regular {
+					b.open, b.once = openOnce(b.open), true
+					return b, nil
+				}
+				f, err := b.open()
+				if err != nil {
+					return bodyTuple{}, err
+				}
+				f.Close()
+			}
+		}
+		return b, nil
 
 	case JSONBody:
 		return buildJSONBody(in.Items)
@@ -90,7 +208,10 @@ func buildJSONBody(items []item) (bodyTuple, error) {
 	for _, item := range items {
 		// Only consider items that are meant for the body (data or raw JSON),
 		// skip others like headers or query params
-		if item.Sep != SepDataString && item.Sep != SepDataRawJSON {
+		if item.Sep != SepDataString &&
+			item.Sep != SepDataRawJSON &&
+			item.Sep != SepDataEmbedFileContents &&
+			item.Sep != SepDataEmbedRawJSONFile {
 			continue
 		}
 
@@ -118,6 +239,18 @@ func buildJSONBody(items []item) (bodyTuple, error) {
 			if err := json.Unmarshal([]byte(item.Val), &v); err != nil {
 				return bodyTuple{}, fmt.Errorf("invalid JSON value for %q: %w", item.Key, err)
 			}
+
+		case SepDataEmbedFileContents:
+			v, err = readEmbedFile(item.Val)
+			if err != nil {
+				return bodyTuple{}, err
+			}
+
+		case SepDataEmbedRawJSONFile:
+			v, err = readEmbedJSONFile(item.Val)
+			if err != nil {
+				return bodyTuple{}, err
+			}
 		}
 
 		// Insert the value into the root object at the specified path.
@@ -305,8 +438,16 @@ func buildFormBody(items []item) (bodyTuple, error) {
 	}
 	vals := url.Values{}
 	for _, it := range items {
-		if it.Sep == SepDataString {
+		switch it.Sep {
+		case SepDataString:
 			vals.Add(it.Key, it.Val)
+
+		case SepDataEmbedFileContents:
+			v, err := readEmbedFile(it.Val)
+			if err != nil {
+				return bodyTuple{}, err
+			}
+			vals.Add(it.Key, v)
 		}
 	}
 	return bodyTuple{
@@ -315,45 +456,341 @@ func buildFormBody(items []item) (bodyTuple, error) {
 	}, nil
 }
 
-// buildMultipartBody constructs the body content and content type for a multipart
-// body based.
+// buildMultipartBody constructs the body content type and stream for a
+// multipart body based. The parts are written through a pipe while the body is
+// read, so the files aren't loaded into memory. The size of the body is known
+// in advance unless some file isn't a regular file (e.g. a named pipe).
 func buildMultipartBody(items []item, boundary string) (bodyTuple, error) {
-	var buf bytes.Buffer
-	var w *multipart.Writer
+	w, err := newMultipartWriter(io.Discard, boundary)
+	if err != nil {
+		return bodyTuple{}, err
+	}
+
+	// Each stream must use the same boundary as the Content-Type.
+	boundary = w.Boundary()
+	size, preview, err := multipartSize(items, boundary)
+	if err != nil {
+		return bodyTuple{}, err
+	}
+	open := func() (io.ReadCloser, error) {
+		pr, pw := io.Pipe()
+		w, err := newMultipartWriter(pw, boundary)
+		if err != nil {
+			return nil, err
+		}
+		return &multipartReader{pr: pr, write: func() {
+			pw.CloseWithError(writeMultipart(w, items))
+		}}, nil
+	}
+	b := bodyTuple{
+		contentType: w.FormDataContentType(),
+		open:        open,
+		size:        size,
+		preview:     preview,
+	}
+
+	// A file that isn't regular can only be read once.
+	if size < 0 {
+		b.open, b.once = openOnce(open), true
+	}
+	return b, nil
+}
+
+// multipartReader is a stream of a multipart body. The parts are written to
+// the pipe by a goroutine started on the first Read, so the files aren't
+// opened if the body is never sent (e.g. a later step of [NewRequest] fails).
+type multipartReader struct {
+	pr    *io.PipeReader
+	write func()
+	once  sync.Once
+}
+
+func (r *multipartReader) Read(p []byte) (int, error) {
+	r.once.Do(func() { go r.write() })
+	return r.pr.Read(p)
+}
+
+// Close closes the pipe, so the goroutine stops writing if it was started.
+func (r *multipartReader) Close() error {
+	return r.pr.Close()
+}
+
+// newMultipartWriter return a multipart.Writer that writes to dst, with a
+// random boundary if boundary is empty.
+func newMultipartWriter(dst io.Writer, boundary string) (*multipart.Writer, error) {
+	w := multipart.NewWriter(dst)
 	if boundary != "" {
-		w = multipart.NewWriter(&buf)
-		w.SetBoundary(boundary)
-	} else {
-		w = multipart.NewWriter(&buf)
+		if err := w.SetBoundary(boundary); err != nil {
+			return nil, fmt.Errorf("invalid boundary %q: %w", boundary, err)
+		}
 	}
+	return w, nil
+}
+
+// writeMultipart write the data and file items as parts of w and then close it.
+func writeMultipart(w *multipart.Writer, items []item) error {
 	for _, it := range items {
-		switch it.Sep {
-		case SepDataString:
-			if err := w.WriteField(it.Key, it.Val); err != nil {
-				return bodyTuple{}, err
+		if it.Sep != SepFileUpload {
+			if err := writeFieldPart(w, it); err != nil {
+				return err
 			}
+			continue
+		}
+		f, h, _, err := openFilePart(it.Key, parseFileUpload(it.Val))
+		if err != nil {
+			return err
+		}
+		part, err := w.CreatePart(h)
+		if err == nil {
+			_, err = io.Copy(part, f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return w.Close()
+}
 
+// multipartSize return the length of the multipart body written by
+// [writeMultipart] with boundary, or -1 if some file isn't a regular file. The
+// file contents aren't read, only their size and the headers of their parts are
+// taken into account. A file that isn't regular isn't opened at all, it can
+// only be read once, by the stream of the body. It also return a preview of the
+// body for the output, with a placeholder in place of the content of each file,
+// or nil if the size is unknown.
+func multipartSize(items []item, boundary string) (int64, []byte, error) {
+	var unknown bool
+	for _, it := range items {
+		var path string
+		switch it.Sep {
 		case SepFileUpload:
-			f, err := os.Open(it.Val)
-			if err != nil {
-				return bodyTuple{}, fmt.Errorf("cannot open file %q: %w", it.Val, err)
-			}
-			part, err := w.CreateFormFile(it.Key, filepath.Base(it.Val))
-			if err != nil {
-				f.Close()
-				return bodyTuple{}, err
-			}
-			if _, err := io.Copy(part, f); err != nil {
-				f.Close()
-				return bodyTuple{}, err
+			path = parseFileUpload(it.Val).Path
+		case SepDataEmbedFileContents:
+			path = it.Val
+		default:
+			continue
+		}
+		regular, err := isRegularFile(path)
+		if err != nil {
+			return 0, nil, err
+		}
+		unknown = unknown || !regular
+	}
+	if unknown {
+		return -1, nil, nil
+	}
+	var cw countWriter
+	var preview bytes.Buffer
+	w, err := newMultipartWriter(io.MultiWriter(&cw, &preview), boundary)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, it := range items {
+		if it.Sep != SepFileUpload {
+			if err := writeFieldPart(w, it); err != nil {
+				return 0, nil, err
 			}
-			f.Close()
+			continue
+		}
+		fu := parseFileUpload(it.Val)
+		f, h, size, err := openFilePart(it.Key, fu)
+		if err != nil {
+			return 0, nil, err
 		}
+		f.Close()
+		if _, err := w.CreatePart(h); err != nil {
+			return 0, nil, err
+		}
+		cw.n += size
+		fmt.Fprintf(&preview, "<content of file %s>", fu.Path)
 	}
 	if err := w.Close(); err != nil {
-		return bodyTuple{}, err
+		return 0, nil, err
+	}
+	return cw.n, preview.Bytes(), nil
+}
+
+// countWriter is an io.Writer that only counts the bytes written to it.
+type countWriter struct {
+	n int64
+}
+
+func (cw *countWriter) Write(p []byte) (int, error) {
+	cw.n += int64(len(p))
+	return len(p), nil
+}
+
+// writeFieldPart write the data item it as a field part of w, other items are
+// ignored.
+func writeFieldPart(w *multipart.Writer, it item) error {
+	switch it.Sep {
+	case SepDataString:
+		return w.WriteField(it.Key, it.Val)
+
+	case SepDataEmbedFileContents:
+		v, err := readEmbedFile(it.Val)
+		if err != nil {
+			return err
+		}
+		return w.WriteField(it.Key, v)
+	}
+	return nil
+}
+
+// openFilePart open the file of fu and return its content along with the
+// header of its part named key, and its size or -1 if it isn't a regular file.
+// The filename and the Content-Type of the part are taken from fu when they are
+// specified, otherwise the base name of the file is used and the Content-Type
+// is guessed from its extension or, as a last resort, by sniffing its content.
+func openFilePart(key string, fu fileUpload) (io.ReadCloser, textproto.MIMEHeader, int64, error) {
+	path, err := expandHome(fu.Path)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("cannot open file %q: %w", fu.Path, err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, 0, err
+	}
+	size := int64(-1)
+	if stat.Mode().IsRegular() {
+		size = stat.Size()
+	}
+
+	// http.DetectContentType considers at most the first 512 bytes.
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		f.Close()
+		return nil, nil, 0, fmt.Errorf("cannot read file %q: %w", fu.Path, err)
+	}
+	head = head[:n]
+
+	filename := fu.Filename
+	if filename == "" {
+		filename = filepath.Base(fu.Path)
+	}
+	contentType := fu.ContentType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(fu.Path))
+	}
+	if contentType == "" {
+		contentType = http.DetectContentType(head)
+	}
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", multipart.FileContentDisposition(key, filename))
+	h.Set("Content-Type", contentType)
+	rc := struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), f), f}
+	return rc, h, size, nil
+}
+
+// openOnce wrap the open function of [bodyTuple] of a body which can only be
+// read once, e.g. stdin, so that it fails after the first call.
+func openOnce(open func() (io.ReadCloser, error)) func() (io.ReadCloser, error) {
+	var opened bool
+	return func() (io.ReadCloser, error) {
+		if opened {
+			return nil, errors.New("the request body from stdin or a pipe cannot be read again")
+		}
+		opened = true
+		return open()
 	}
-	return bodyTuple{content: buf.Bytes(), contentType: w.FormDataContentType()}, nil
+}
+
+// hashBody return the SHA-256 of the body b. A streamed body is read from a new
+// stream, the request has its own.
+func hashBody(b bodyTuple) ([]byte, error) {
+	h := sha256.New()
+	h.Write(b.content)
+	if b.open != nil {
+		rc, err := b.open()
+		if err != nil {
+			return nil, err
+		}
+		defer rc.Close()
+		if _, err := io.Copy(h, rc); err != nil {
+			return nil, err
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// isRegularFile report whether the file at path is a regular file, which can
+// be read more than once, unlike e.g. a named pipe.
+func isRegularFile(path string) (bool, error) {
+	p, err := expandHome(path)
+	if err != nil {
+		return false, err
+	}
+	stat, err := os.Stat(p)
+	if err != nil {
+		return false, fmt.Errorf("cannot open file %q: %w", path, err)
+	}
+	return stat.Mode().IsRegular(), nil
+}
+
+// readEmbedFile return the contents of the file at path as a string, used by
+// the separators that embed a file in place of a value (e.g. `field=@file.txt`).
+// The file must exist and its contents must be valid UTF-8 text, otherwise
+// return error.
+func readEmbedFile(path string) (string, error) {
+	path, err := expandHome(path)
+	if err != nil {
+		return "", err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot open file %q: %w", path, err)
+	}
+	if !utf8.Valid(b) {
+		return "", fmt.Errorf("cannot embed the content of %q, not a UTF-8 or ASCII-encoded text file", path)
+	}
+	return string(b), nil
+}
+
+// readEmbedJSONFile return the decoded JSON document of the file at path, used
+// by the `field:=@file.json` separator. If the file isn't valid JSON the error
+// includes the file name and the byte offset where decoding failed.
+func readEmbedJSONFile(path string) (any, error) {
+	path, err := expandHome(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file %q: %w", path, err)
+	}
+	var v any
+	if err := json.Unmarshal(b, &v); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			return nil, fmt.Errorf("invalid JSON file %q at offset %d: %w", path, syntaxErr.Offset, err)
+		}
+		return nil, fmt.Errorf("invalid JSON file %q: %w", path, err)
+	}
+	return v, nil
+}
+
+// expandHome replace a leading `~` in path with the home directory of the
+// current user, the shell doesn't expand it after a separator (e.g.
+// `Authorization:@~/.tokens/staging`).
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot expand %q: %w", path, err)
+	}
+	return filepath.Join(home, path[1:]), nil
 }
 
 // buildURLQuery add the Key and Val values from in.Items to the URL Query string
@@ -361,8 +798,19 @@ func buildMultipartBody(items []item, boundary string) (bodyTuple, error) {
 func (r *request) buildURLQuery(in *Input) error {
 	query := r.URL.Query()
 	for _, it := range in.Items {
-		if it.Sep == SepQueryParam {
+		switch it.Sep {
+		case SepQueryParam:
 			query.Add(it.Key, it.Val)
+
+		case SepQueryEmbedFile:
+			v, err := readEmbedFile(it.Val)
+			if err != nil {
+				return err
+			}
+
+			// Editors usually end files with a newline, which isn't meant to be
+			// part of the value.
+			query.Add(it.Key, strings.TrimRight(v, "\r\n"))
 		}
 	}
 	r.URL.RawQuery = query.Encode()
@@ -385,6 +833,21 @@ func (r *request) buildHeaders(in *Input) error {
 				return fmt.Errorf("invalid item %s (to specify an empty header use `Header;`)", i.Orig)
 			}
 			r.Header.Add(i.Key, i.Val)
+
+		case SepHeaderEmbed:
+			v, err := readEmbedFile(i.Val)
+			if err != nil {
+				return err
+			}
+			v = strings.TrimRight(v, "\r\n")
+			if strings.ContainsAny(v, "\r\n") {
+				return fmt.Errorf("invalid header value from file %q: it must not contain CR or LF characters", i.Val)
+			}
+			if strings.EqualFold(i.Key, "Host") {
+				r.Host = v
+			} else {
+				r.Header.Add(i.Key, v)
+			}
 		}
 	}
 	return nil
@@ -1,10 +1,17 @@
 package ihttp
 
 import (
+	"bytes"
 	"encoding/json"
+	"io"
+	"mime/multipart"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -320,6 +327,26 @@ func TestBuildJSONBody(t *testing.T) {
 			args: []string{":", `:={"foo": {"bar": "baz"}}`, "top=val"},
 			want: `{"":{"foo":{"bar":"baz"}},"top":"val"}`,
 		},
+		{
+			name: "embed file contents",
+			args: []string{":", "text=@examples/plain.txt", "foo=bar"},
+			want: `{"foo":"bar","text":"lorem ipsum"}`,
+		},
+		{
+			name: "embed file contents nested",
+			args: []string{":", "note[body]=@examples/plain.txt", "note[tags][]=@examples/json.txt"},
+			want: `{"note":{"body":"lorem ipsum","tags":["{\"hello\": \"world\"}"]}}`,
+		},
+		{
+			name: "embed raw JSON file",
+			args: []string{":", "customer:=@examples/data.json", "id=1"},
+			want: `{"customer":{"hello":"world"},"id":"1"}`,
+		},
+		{
+			name: "embed raw JSON file append array",
+			args: []string{":", "items[]:=@examples/data.json", "items[]:=@examples/quotes.json"},
+			want: `{"items":[{"hello":"world"},{"test":"Single 'quotes' inside 'this' string are gone"}]}`,
+		},
 		{
 			name:        "invalid key with unclosed bracket",
 			args:        []string{":", "A[:=1"},
@@ -519,6 +546,30 @@ func TestBuildJSONBodyErrors(t *testing.T) {
 			wantErrContains: `missing '[' in "foo[bar][1]\\[14[]"`,
 			errExpected:     true,
 		},
+		{
+			name:            "embed missing file",
+			args:            []string{":", "text=@examples/missing.txt"},
+			wantErrContains: `cannot open file "examples/missing.txt"`,
+			errExpected:     true,
+		},
+		{
+			name:            "embed non UTF-8 file",
+			args:            []string{":", "text=@examples/latin1.txt"},
+			wantErrContains: `cannot embed the content of "examples/latin1.txt", not a UTF-8 or ASCII-encoded text file`,
+			errExpected:     true,
+		},
+		{
+			name:            "embed missing JSON file",
+			args:            []string{":", "customer:=@examples/missing.json"},
+			wantErrContains: `cannot open file "examples/missing.json"`,
+			errExpected:     true,
+		},
+		{
+			name:            "embed invalid JSON file",
+			args:            []string{":", "customer:=@examples/plain.txt"},
+			wantErrContains: `invalid JSON file "examples/plain.txt" at offset 1`,
+			errExpected:     true,
+		},
 	}
 	for _, tc := range tt {
 		t.Run(tc.name, func(t *testing.T) {
@@ -587,6 +638,18 @@ func TestBuildRequestBody(t *testing.T) {
 			opts:     Options{Raw: `{"foo":"bar"}`},
 			wantType: "application/json",
 		},
+		{
+			name:     "url @file.txt",
+			args:     []string{":", "@examples/plain.txt"},
+			opts:     Options{},
+			wantType: "text/plain; charset=utf-8",
+		},
+		{
+			name:     "url @file.json",
+			args:     []string{":", "@examples/data.json"},
+			opts:     Options{},
+			wantType: "application/json",
+		},
 	}
 
 	for _, tc := range tt {
@@ -617,6 +680,406 @@ func TestBuildRequestBody(t *testing.T) {
 	}
 }
 
+func TestBuildMultipartBody(t *testing.T) {
+	dir := t.TempDir()
+	image := filepath.Join(dir, "image")
+	if err := os.WriteFile(image, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\x0dIHDR"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	tt := []struct {
+		name         string
+		item         string
+		wantFilename string
+		wantType     string
+	}{
+		{
+			name:         "type from extension",
+			item:         "file@examples/plain.txt",
+			wantFilename: "plain.txt",
+			wantType:     "text/plain; charset=utf-8",
+		},
+		{
+			name:         "type from content",
+			item:         "avatar@" + image,
+			wantFilename: "image",
+			wantType:     "image/png",
+		},
+		{
+			name:         "type override",
+			item:         "avatar@" + image + ";type=image/x-png",
+			wantFilename: "image",
+			wantType:     "image/x-png",
+		},
+		{
+			name:         "filename override",
+			item:         "doc@examples/data.json;filename=customer.json",
+			wantFilename: "customer.json",
+			wantType:     "application/json",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			it, err := parseItem(tc.item, SepsGroupAllItems())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := buildMultipartBody([]item{it}, "boundary")
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := got.open()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer body.Close()
+			r := multipart.NewReader(body, "boundary")
+			part, err := r.NextPart()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if part.FormName() != it.Key {
+				t.Errorf("want form name %q, got %q", it.Key, part.FormName())
+			}
+			if part.FileName() != tc.wantFilename {
+				t.Errorf("want filename %q, got %q", tc.wantFilename, part.FileName())
+			}
+			if ct := part.Header.Get("Content-Type"); ct != tc.wantType {
+				t.Errorf("want content type %q, got %q", tc.wantType, ct)
+			}
+		})
+	}
+}
+
+func TestBuildMultipartBodySize(t *testing.T) {
+	items := []item{
+		{Key: "foo", Val: "bar", Sep: SepDataString},
+		{Key: "note", Val: "examples/plain.txt", Sep: SepDataEmbedFileContents},
+		{Key: "doc", Val: "examples/data.xml", Sep: SepFileUpload},
+		{Key: "file", Val: "examples/quotes.json;filename=q.json", Sep: SepFileUpload},
+	}
+	got, err := buildMultipartBody(items, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := func() []byte {
+		body, err := got.open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer body.Close()
+		b, err := io.ReadAll(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	first := read()
+	if int64(len(first)) != got.size {
+		t.Errorf("want size %d, got %d", len(first), got.size)
+	}
+
+	// The body can be produced again, e.g. to follow a redirect.
+	if second := read(); !bytes.Equal(first, second) {
+		t.Errorf("the body changed between reads\nfirst\t%q\nsecond\t%q", first, second)
+	}
+}
+
+// TestBuildMultipartBodyLazy checks that the files are opened on the first
+// Read of the stream, so nothing is left open if the body is never sent.
+func TestBuildMultipartBodyLazy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upload.txt")
+	if err := os.WriteFile(path, []byte("lorem ipsum"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	got, err := buildMultipartBody([]item{{Key: "file", Val: path, Sep: SepFileUpload}}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := got.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The file is removed before the first Read, which must fail.
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(body); err == nil {
+		t.Error("the file was opened before the first Read")
+	}
+	body.Close()
+
+	// Closing a stream that was never read doesn't block.
+	body, err = got.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := body.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildMultipartBodyPipe(t *testing.T) {
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Close()
+	content := strings.Repeat("A", 600) + strings.Repeat("B", 600)
+	if _, err := io.WriteString(pw, content); err != nil {
+		t.Fatal(err)
+	}
+	pw.Close()
+
+	// The pipe is opened again by its path, like a named pipe.
+	path := "/dev/fd/" + strconv.Itoa(int(pr.Fd()))
+	items := []item{
+		{Key: "name", Val: "ihttp", Sep: SepDataString},
+		{Key: "file", Val: path, Sep: SepFileUpload},
+	}
+	got, err := buildMultipartBody(items, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.size != -1 || !got.once {
+		t.Errorf("got size %d and once %v, want -1 and true", got.size, got.once)
+	}
+	body, err := got.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "\r\n\r\n"+content+"\r\n--") {
+		t.Errorf("the content of the pipe isn't in the body %q", b)
+	}
+	if _, err := got.open(); err == nil {
+		t.Error("the body from a pipe was opened twice")
+	}
+}
+
+func TestBuildMultipartBodyMissingFile(t *testing.T) {
+	items := []item{{Key: "file", Val: "examples/missing.txt", Sep: SepFileUpload}}
+	_, err := buildMultipartBody(items, "")
+	if err == nil || !strings.Contains(err.Error(), `cannot open file "examples/missing.txt"`) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestNewRequestChunked(t *testing.T) {
+	tt := []struct {
+		name     string
+		in       *Input
+		wantBody string
+	}{
+		{
+			name: "stdin",
+			in: &Input{
+				Options:  Options{Chunked: true},
+				Method:   http.MethodPost,
+				BodyType: RawBody,
+				stdin:    strings.NewReader("lorem ipsum"),
+			},
+			wantBody: "lorem ipsum",
+		},
+		{
+			name: "@file",
+			in: &Input{
+				Options:  Options{Chunked: true},
+				Method:   http.MethodPost,
+				Items:    []item{{Val: "examples/plain.txt", Sep: SepFileUpload}},
+				BodyType: RawBody,
+			},
+			wantBody: "lorem ipsum",
+		},
+		{
+			name: "json",
+			in: &Input{
+				Options:  Options{Chunked: true},
+				Method:   http.MethodPost,
+				Items:    []item{{Key: "foo", Val: "bar", Sep: SepDataString}},
+				BodyType: JSONBody,
+			},
+			wantBody: `{"foo":"bar"}`,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if !reflect.DeepEqual(r.TransferEncoding, []string{"chunked"}) {
+					t.Errorf("want chunked transfer encoding, got %v", r.TransferEncoding)
+				}
+				b, err := io.ReadAll(r.Body)
+				if err != nil {
+					t.Error(err)
+				}
+				if string(b) != tc.wantBody {
+					t.Errorf("want body %q, got %q", tc.wantBody, b)
+				}
+			}))
+			defer srv.Close()
+			tc.in.URL = srv.URL
+			req, _, err := NewRequest(tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+		})
+	}
+}
+
+func TestNewRequestMultipart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if len(r.TransferEncoding) > 0 {
+			t.Errorf("want no transfer encoding, got %v", r.TransferEncoding)
+		}
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		if r.ContentLength != int64(len(b)) {
+			t.Errorf("want content length %d, got %d", len(b), r.ContentLength)
+		}
+	}))
+	defer srv.Close()
+	in := &Input{
+		Options: Options{Multipart: true},
+		Method:  http.MethodPost,
+		URL:     srv.URL,
+		Items: []item{
+			{Key: "foo", Val: "bar", Sep: SepDataString},
+			{Key: "file", Val: "examples/plain.txt", Sep: SepFileUpload},
+		},
+		BodyType: MultipartBody,
+	}
+	req, _, err := NewRequest(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestNewRequestChunkedMultipart(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength != -1 {
+			t.Errorf("want unknown content length, got %d", r.ContentLength)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Error(err)
+			return
+		}
+		if got := r.FormValue("foo"); got != "bar" {
+			t.Errorf("want field foo %q, got %q", "bar", got)
+		}
+		f, _, err := r.FormFile("file")
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer f.Close()
+		b, _ := io.ReadAll(f)
+		if string(b) != "lorem ipsum" {
+			t.Errorf("want file %q, got %q", "lorem ipsum", b)
+		}
+	}))
+	defer srv.Close()
+	in := &Input{
+		Options: Options{Multipart: true, Chunked: true},
+		Method:  http.MethodPost,
+		URL:     srv.URL,
+		Items: []item{
+			{Key: "foo", Val: "bar", Sep: SepDataString},
+			{Key: "file", Val: "examples/plain.txt", Sep: SepFileUpload},
+		},
+		BodyType: MultipartBody,
+	}
+	req, _, err := NewRequest(in)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+}
+
+func TestVerboseStreamedBody(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		if err != nil || len(b) == 0 {
+			t.Errorf("the body wasn't sent: %q, %v", b, err)
+		}
+	}))
+	defer srv.Close()
+	tt := []struct {
+		name     string
+		in       *Input
+		want     []string
+		dontWant string
+	}{
+		{
+			name: "multipart",
+			in: &Input{
+				Options: Options{Multipart: true, Verbose: true},
+				Items: []item{
+					{Key: "foo", Val: "bar", Sep: SepDataString},
+					{Key: "file", Val: "examples/plain.txt", Sep: SepFileUpload},
+				},
+				BodyType: MultipartBody,
+			},
+			want: []string{
+				"Content-Disposition: form-data; name=\"foo\"\r\n\r\nbar\r\n",
+				"Content-Type: text/plain; charset=utf-8\r\n\r\n<content of file examples/plain.txt>\r\n",
+			},
+			dontWant: "lorem ipsum",
+		},
+		{
+			name: "chunked stdin",
+			in: &Input{
+				Options:  Options{Chunked: true, Verbose: true},
+				BodyType: RawBody,
+				stdin:    strings.NewReader("lorem ipsum"),
+			},
+			want: []string{"\n<streamed body>\n"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.in.Method = http.MethodPost
+			tc.in.URL = srv.URL
+			req, body, err := NewRequest(tc.in)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := NewOutput(req, body, tc.in.Options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("missing %q in\n%s", want, out.String())
+				}
+			}
+			if tc.dontWant != "" && strings.Contains(out.String(), tc.dontWant) {
+				t.Errorf("unexpected %q in\n%s", tc.dontWant, out.String())
+			}
+		})
+	}
+}
+
 func containsFile(items []item) bool {
 	for _, it := range items {
 		if it.Sep == SepFileUpload {
@@ -679,6 +1142,26 @@ func TestBuildHeaders(t *testing.T) {
 			},
 			errExpected: false,
 		},
+		{
+			name: "Header:@file",
+			args: []string{"httpbingo.org/get", "Authorization:@examples/plain.txt"},
+			want: http.Header{
+				"Authorization": []string{"lorem ipsum"},
+			},
+			errExpected: false,
+		},
+		{
+			name:        "Header:@file with line breaks",
+			args:        []string{"httpbingo.org/get", "X-Data:@examples/quotes.json"},
+			want:        http.Header{},
+			errExpected: true,
+		},
+		{
+			name:        "Header:@missing",
+			args:        []string{"httpbingo.org/get", "Authorization:@examples/missing.txt"},
+			want:        http.Header{},
+			errExpected: true,
+		},
 	}
 	opts := Options{}
 	for _, tc := range tt {
@@ -704,11 +1187,36 @@ func TestBuildHeaders(t *testing.T) {
 	}
 }
 
+func TestExpandHome(t *testing.T) {
+	t.Setenv("HOME", "/home/gopher")
+	tt := []struct {
+		path string
+		want string
+	}{
+		{path: "~", want: "/home/gopher"},
+		{path: "~/.tokens/staging", want: "/home/gopher/.tokens/staging"},
+		{path: "~gopher/token", want: "~gopher/token"},
+		{path: "examples/plain.txt", want: "examples/plain.txt"},
+	}
+	for _, tc := range tt {
+		t.Run(tc.path, func(t *testing.T) {
+			got, err := expandHome(tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
 func TestBuildURLQuery(t *testing.T) {
 	tt := []struct {
-		name string
-		args []string
-		want url.Values
+		name        string
+		args        []string
+		want        url.Values
+		errExpected bool
 	}{
 		{
 			name: "query==value",
@@ -724,6 +1232,19 @@ func TestBuildURLQuery(t *testing.T) {
 				"query": []string{"value"},
 			},
 		},
+		{
+			name: "query==@file",
+			args: []string{"httpbingo.org/get", "q==@examples/query.txt", "per_page==1"},
+			want: url.Values{
+				"q":        []string{"status:open label:bug"},
+				"per_page": []string{"1"},
+			},
+		},
+		{
+			name:        "query==@missing",
+			args:        []string{"httpbingo.org/get", "q==@examples/missing.txt"},
+			errExpected: true,
+		},
 	}
 	opts := Options{}
 	for _, tc := range tt {
@@ -737,8 +1258,12 @@ func TestBuildURLQuery(t *testing.T) {
 				t.Fatal(err)
 			}
 			r := &request{req}
-			if err := r.buildURLQuery(inp); err != nil {
-				t.Fatal(err)
+			err = r.buildURLQuery(inp)
+			if (err != nil) != tc.errExpected {
+				t.Fatalf("%s: unexpected error status: %v", tc.name, err)
+			}
+			if tc.errExpected {
+				return
 			}
 			//fmt.Printf("URL      %+v\n", r.Request.URL)          // httpbingo.org/get?query=value
 			//fmt.Printf("RawQuery %+v\n", r.Request.URL.RawQuery) // query=value
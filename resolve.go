@@ -0,0 +1,161 @@
+package ihttp
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// addrRewriter rewrites the addresses the transport connects to, like the
+// --connect-to and --resolve options of curl. The URL isn't changed, so the
+// Host header and the TLS server name are still the ones of its host.
+type addrRewriter struct {
+	connectTo []connectTo
+	resolve   []resolveEntry
+}
+
+// connectTo rewrites the host and port fromHost:fromPort to toHost:toPort,
+// an empty field matches any host or port, or keeps the original one.
+type connectTo struct {
+	fromHost, fromPort string
+	toHost, toPort     string
+}
+
+// resolveEntry resolves the host (or any host if it's `*`) to addrs for the
+// connections to port.
+type resolveEntry struct {
+	host  string
+	port  string
+	addrs []string
+}
+
+// newAddrRewriter return an addrRewriter from the values of Options.Resolve
+// and Options.ConnectTo, or nil if both are empty.
+func newAddrRewriter(resolve, connectTo []string) (*addrRewriter, error) {
+	if len(resolve) == 0 && len(connectTo) == 0 {
+		return nil, nil
+	}
+	r := &addrRewriter{}
+	for _, s := range connectTo {
+		c, err := parseConnectTo(s)
+		if err != nil {
+			return nil, err
+		}
+		r.connectTo = append(r.connectTo, c)
+	}
+	for _, s := range resolve {
+		e, err := parseResolve(s)
+		if err != nil {
+			return nil, err
+		}
+		r.resolve = append(r.resolve, e)
+	}
+	return r, nil
+}
+
+// parseConnectTo parse s in the form `HOST1:PORT1:HOST2:PORT2`.
+func parseConnectTo(s string) (connectTo, error) {
+	var fields [4]string
+	rest := s
+	for i := range fields {
+		var ok bool
+		fields[i], rest, ok = cutHost(rest)
+		if ok != (i < 3) {
+			return connectTo{}, fmt.Errorf("invalid -connect-to %q (expected HOST1:PORT1:HOST2:PORT2)", s)
+		}
+	}
+	for _, port := range []string{fields[1], fields[3]} {
+		if port != "" && !isPort(port) {
+			return connectTo{}, fmt.Errorf("invalid -connect-to %q: invalid port %q", s, port)
+		}
+	}
+	return connectTo{fromHost: fields[0], fromPort: fields[1], toHost: fields[2], toPort: fields[3]}, nil
+}
+
+// parseResolve parse s in the form `HOST:PORT:ADDR[,ADDR]...`, where the
+// addresses are IPs, the IPv6 ones can be in brackets.
+func parseResolve(s string) (resolveEntry, error) {
+	host, rest, ok1 := cutHost(s)
+	port, addrs, ok2 := strings.Cut(rest, ":")
+	if !ok1 || !ok2 || host == "" || addrs == "" {
+		return resolveEntry{}, fmt.Errorf("invalid -resolve %q (expected HOST:PORT:ADDR)", s)
+	}
+	if !isPort(port) {
+		return resolveEntry{}, fmt.Errorf("invalid -resolve %q: invalid port %q", s, port)
+	}
+	e := resolveEntry{host: host, port: port}
+	for _, addr := range strings.Split(addrs, ",") {
+		addr = strings.TrimSuffix(strings.TrimPrefix(addr, "["), "]")
+		if net.ParseIP(addr) == nil {
+			return resolveEntry{}, fmt.Errorf("invalid -resolve %q: %q isn't an IP address", s, addr)
+		}
+		e.addrs = append(e.addrs, addr)
+	}
+	return e, nil
+}
+
+// cutHost slices s around the first colon after the host at its beginning,
+// which can be an IPv6 address in brackets. The brackets are removed.
+func cutHost(s string) (host, rest string, found bool) {
+	end := strings.Index(s, "]")
+	if !strings.HasPrefix(s, "[") || end < 0 {
+		return strings.Cut(s, ":")
+	}
+	rest, found = strings.CutPrefix(s[end+1:], ":")
+	return s[1:end], rest, found
+}
+
+// isPort returns true if s is a port number.
+func isPort(s string) bool {
+	n, err := strconv.Atoi(s)
+	return err == nil && n > 0 && n <= 65535
+}
+
+// rewrite return the addresses to connect to instead of addr, to be tried in
+// order. The first matching connectTo is applied, and then the first matching
+// resolveEntry.
+func (r *addrRewriter) rewrite(addr string) []string {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return []string{addr}
+	}
+	for _, c := range r.connectTo {
+		if (c.fromHost == "" || strings.EqualFold(c.fromHost, host)) && (c.fromPort == "" || c.fromPort == port) {
+			if c.toHost != "" {
+				host = c.toHost
+			}
+			if c.toPort != "" {
+				port = c.toPort
+			}
+			break
+		}
+	}
+	for _, e := range r.resolve {
+		if (e.host == "*" || strings.EqualFold(e.host, host)) && e.port == port {
+			addrs := make([]string, len(e.addrs))
+			for i, a := range e.addrs {
+				addrs[i] = net.JoinHostPort(a, port)
+			}
+			return addrs
+		}
+	}
+	return []string{net.JoinHostPort(host, port)}
+}
+
+// dialContext return a DialContext function that connects with dial to the
+// addresses rewritten by r, the first one that succeeds is used.
+func (r *addrRewriter) dialContext(dial func(ctx context.Context, network, addr string) (net.Conn, error)) func(ctx context.Context, network, addr string) (net.Conn, error) {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		var err error
+		for _, a := range r.rewrite(addr) {
+			var conn net.Conn
+			conn, err = dial(ctx, network, a)
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+}
@@ -0,0 +1,198 @@
+package ihttp
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestParseResolve(t *testing.T) {
+	tt := []struct {
+		name        string
+		s           string
+		want        resolveEntry
+		errExpected bool
+	}{
+		{
+			name: "IPv4",
+			s:    "api.example.com:443:10.0.0.7",
+			want: resolveEntry{host: "api.example.com", port: "443", addrs: []string{"10.0.0.7"}},
+		},
+		{
+			name: "several addresses",
+			s:    "api.example.com:443:10.0.0.7,[::1]",
+			want: resolveEntry{host: "api.example.com", port: "443", addrs: []string{"10.0.0.7", "::1"}},
+		},
+		{
+			name: "any host",
+			s:    "*:80:127.0.0.1",
+			want: resolveEntry{host: "*", port: "80", addrs: []string{"127.0.0.1"}},
+		},
+		{
+			name:        "host name as address",
+			s:           "api.example.com:443:lb.example.com",
+			errExpected: true,
+		},
+		{
+			name:        "missing port",
+			s:           "api.example.com:10.0.0.7",
+			errExpected: true,
+		},
+		{
+			name:        "missing address",
+			s:           "api.example.com:443:",
+			errExpected: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseResolve(tc.s)
+			if (err != nil) != tc.errExpected {
+				t.Fatalf("%s: unexpected error status: %v", tc.s, err)
+			}
+			if !tc.errExpected && !reflect.DeepEqual(tc.want, got) {
+				t.Errorf("%s\nwant\t%#v\ngot\t%#v", tc.s, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestParseConnectTo(t *testing.T) {
+	tt := []struct {
+		name        string
+		s           string
+		want        connectTo
+		errExpected bool
+	}{
+		{
+			name: "all the fields",
+			s:    "api.example.com:443:lb.example.com:8443",
+			want: connectTo{fromHost: "api.example.com", fromPort: "443", toHost: "lb.example.com", toPort: "8443"},
+		},
+		{
+			name: "empty fields",
+			s:    "::lb.example.com:",
+			want: connectTo{toHost: "lb.example.com"},
+		},
+		{
+			name: "IPv6",
+			s:    "[::1]:80:[fe80::1]:8080",
+			want: connectTo{fromHost: "::1", fromPort: "80", toHost: "fe80::1", toPort: "8080"},
+		},
+		{
+			name:        "missing fields",
+			s:           "api.example.com:443:lb.example.com",
+			errExpected: true,
+		},
+		{
+			name:        "invalid port",
+			s:           "api.example.com:https:lb.example.com:8443",
+			errExpected: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseConnectTo(tc.s)
+			if (err != nil) != tc.errExpected {
+				t.Fatalf("%s: unexpected error status: %v", tc.s, err)
+			}
+			if !tc.errExpected && tc.want != got {
+				t.Errorf("%s\nwant\t%#v\ngot\t%#v", tc.s, tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAddrRewriter(t *testing.T) {
+	r, err := newAddrRewriter(
+		[]string{"lb.example.com:8443:10.0.0.7,10.0.0.8", "api.example.com:80:10.0.0.9"},
+		[]string{"api.example.com:443:lb.example.com:8443", ":8080::80"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := []struct {
+		addr string
+		want []string
+	}{
+		{addr: "api.example.com:443", want: []string{"10.0.0.7:8443", "10.0.0.8:8443"}},
+		{addr: "api.example.com:8080", want: []string{"10.0.0.9:80"}},
+		{addr: "api.example.com:80", want: []string{"10.0.0.9:80"}},
+		{addr: "other.example.com:8080", want: []string{"other.example.com:80"}},
+		{addr: "other.example.com:443", want: []string{"other.example.com:443"}},
+	}
+	for _, tc := range tt {
+		if got := r.rewrite(tc.addr); !reflect.DeepEqual(tc.want, got) {
+			t.Errorf("%s\nwant\t%q\ngot\t%q", tc.addr, tc.want, got)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	var serverName atomic.Value
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, r.Host)
+	}))
+	srv.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			serverName.Store(hello.ServerName)
+			return nil, nil
+		},
+	}
+	srv.StartTLS()
+	defer srv.Close()
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	tt := []struct {
+		name string
+		url  string
+		opts Options
+		want string
+	}{
+		{
+			name: "resolve",
+			url:  "https://api.example.com:" + port,
+			opts: Options{Resolve: []string{"api.example.com:" + port + ":127.0.0.1"}},
+			want: "api.example.com:" + port,
+		},
+		{
+			name: "connect to",
+			url:  "https://api.example.com",
+			opts: Options{ConnectTo: []string{"api.example.com:443:127.0.0.1:" + port}},
+			want: "api.example.com",
+		},
+		{
+			name: "connect to and resolve",
+			url:  "https://api.example.com",
+			opts: Options{
+				ConnectTo: []string{"api.example.com:443:lb.example.com:" + port},
+				Resolve:   []string{"lb.example.com:" + port + ":127.0.0.1"},
+			},
+			want: "api.example.com",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.opts.Verify = "no"
+			out, err := NewOutput(req, nil, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(out.String(), "\n"+tc.want) {
+				t.Errorf("\ngot\t%q\nwant Host\t%q", out.String(), tc.want)
+			}
+			if got := serverName.Load(); got != "api.example.com" {
+				t.Errorf("want TLS server name %q, got %q", "api.example.com", got)
+			}
+		})
+	}
+}
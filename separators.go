@@ -7,9 +7,12 @@ const (
 	SepHeader      = ":"
 	SepHeaderEmpty = ";"
 
-	//SepCredentials           = ":"
+	// Only in the value of -auth, e.g. `-auth user:pass`.
+	SepCredentials = ":"
+
 	//SepProxy                 = ":"
-	//SepHeaderEmbed           = ":@"
+
+	SepHeaderEmbed = ":@"
 
 	SepDataString = "="
 
@@ -17,13 +20,17 @@ const (
 
 	SepFileUpload = "@"
 
-	//SepFileUploadType        = ";type=" // in already parsed file upload path only
-	//SepDataEmbedFileContents = "=@"
-	//SepDataEmbedRawJSONFile  = ":=@"
+	// Only in already parsed file upload path, e.g. `avatar@me.png;type=image/png`.
+	SepFileUploadType     = ";type="
+	SepFileUploadFilename = ";filename="
+
+	SepDataEmbedFileContents = "=@"
+
+	SepDataEmbedRawJSONFile = ":=@"
 
 	SepQueryParam = "=="
 
-	//SepQueryEmbedFile        = "==@"
+	SepQueryEmbedFile = "==@"
 )
 
 // SepsGroupNestedJSONItems return separators for nested JSON data type Items.
@@ -31,8 +38,8 @@ func SepsGroupNestedJSONItems() []string {
 	return sortSeps([]string{
 		SepDataString,
 		SepDataRawJSON,
-		//SepDataEmbedFileContents,
-		//SepDataEmbedRawJSONFile,
+		SepDataEmbedFileContents,
+		SepDataEmbedRawJSONFile,
 	})
 }
 
@@ -42,8 +49,8 @@ func SepsGroupDataItems() []string {
 		SepDataString,
 		SepDataRawJSON,
 		SepFileUpload,
-		//SepDataEmbedFileContents,
-		//SepDataEmbedRawJSONFile,
+		SepDataEmbedFileContents,
+		SepDataEmbedRawJSONFile,
 	})
 }
 
@@ -52,14 +59,14 @@ func SepsGroupAllItems() []string {
 	return sortSeps([]string{
 		SepHeader,
 		SepHeaderEmpty,
-		//SepHeaderEmbed,
+		SepHeaderEmbed,
 		SepQueryParam,
-		//SepQueryEmbedFile,
+		SepQueryEmbedFile,
 		SepDataString,
 		SepDataRawJSON,
 		SepFileUpload,
-		//SepDataEmbedFileContents,
-		//SepDataEmbedRawJSONFile,
+		SepDataEmbedFileContents,
+		SepDataEmbedRawJSONFile,
 	})
 }
 
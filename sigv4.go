@@ -0,0 +1,308 @@
+package ihttp
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// sigV4Algorithm is the signing algorithm of AWS Signature Version 4.
+const sigV4Algorithm = "AWS4-HMAC-SHA256"
+
+// sigV4UnsignedPayload is the hash of a body that isn't signed, used for a body
+// streamed to S3 that can only be read once.
+const sigV4UnsignedPayload = "UNSIGNED-PAYLOAD"
+
+// sigV4Unsigned are the headers that aren't signed, since proxies or the
+// transport may change them.
+var sigV4Unsigned = map[string]bool{
+	"Authorization":     true,
+	"User-Agent":        true,
+	"Expect":            true,
+	"Transfer-Encoding": true,
+	"X-Amzn-Trace-Id":   true,
+}
+
+// awsCredentials are the credentials of an AWS access key.
+type awsCredentials struct {
+	accessKey    string
+	secretKey    string
+	sessionToken string
+}
+
+// loadAWSCredentials return the AWS credentials of auth (`ACCESS_KEY:SECRET`)
+// or, if it's empty, of the AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN environment variables or of the AWS_PROFILE profile (or
+// default) in the shared credentials file.
+func loadAWSCredentials(auth string) (awsCredentials, error) {
+	if auth != "" {
+		key, secret, _ := strings.Cut(auth, SepCredentials)
+		return awsCredentials{accessKey: key, secretKey: secret}, nil
+	}
+	if key, secret := os.Getenv("AWS_ACCESS_KEY_ID"), os.Getenv("AWS_SECRET_ACCESS_KEY"); key != "" && secret != "" {
+		return awsCredentials{accessKey: key, secretKey: secret, sessionToken: os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		file = "~/.aws/credentials"
+	}
+	file, err := expandHome(file)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	b, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return awsCredentials{}, fmt.Errorf("cannot read the AWS credentials file: %w", err)
+	}
+	values := parseINISection(string(b), profile)
+	c := awsCredentials{
+		accessKey:    values["aws_access_key_id"],
+		secretKey:    values["aws_secret_access_key"],
+		sessionToken: values["aws_session_token"],
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return awsCredentials{}, fmt.Errorf("no AWS credentials found, set -auth, the AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY environment variables, or the profile %q in %s", profile, file)
+	}
+	return c, nil
+}
+
+// parseINISection return the keys and values of the section of the INI file
+// with the content s.
+func parseINISection(s, section string) map[string]string {
+	values := map[string]string{}
+	var in bool
+	sc := bufio.NewScanner(strings.NewReader(s))
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+		case strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]"):
+			in = strings.TrimSpace(line[1:len(line)-1]) == section
+		case in:
+			k, v, ok := strings.Cut(line, "=")
+			if ok {
+				values[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+			}
+		}
+	}
+	return values
+}
+
+// awsRegionService return the region and the service of an AWS endpoint from
+// its host, e.g. `execute-api` and `us-east-1` for
+// `abc123.execute-api.us-east-1.amazonaws.com`.
+func awsRegionService(host string) (region, service string, ok bool) {
+	labels := strings.Split(strings.TrimSuffix(host, ".amazonaws.com"), ".")
+	if !strings.HasSuffix(host, ".amazonaws.com") || len(labels) < 2 {
+		return "", "", false
+	}
+	return labels[len(labels)-1], labels[len(labels)-2], true
+}
+
+// signAWS sign the request with AWS Signature Version 4 if Options.AuthType
+// is aws-sigv4, and there isn't an Authorization item. A streamed body is
+// hashed from a new stream, except if it can only be read once (stdin with
+// -chunked or a pipe), which is only supported by S3 as UNSIGNED-PAYLOAD.
+func (r *request) signAWS(in *Input, b bodyTuple) error {
+	if authType(in.Options) != AuthAWSSigV4 {
+		return nil
+	}
+	if _, ok := r.Header["Authorization"]; ok {
+		return nil
+	}
+	creds, err := loadAWSCredentials(in.Options.Auth)
+	if err != nil {
+		return err
+	}
+	region, service := in.Options.AWSRegion, in.Options.AWSService
+	if region == "" || service == "" {
+		hostRegion, hostService, ok := awsRegionService(r.URL.Hostname())
+		if !ok {
+			return errors.New("-auth-type aws-sigv4 requires -aws-region and -aws-service for this host")
+		}
+		if region == "" {
+			region = hostRegion
+		}
+		if service == "" {
+			service = hostService
+		}
+	}
+	var payloadHash string
+	switch {
+	case b.open == nil:
+		payloadHash = hashHex(b.content)
+	case !b.once:
+		sum, err := hashBody(b)
+		if err != nil {
+			return fmt.Errorf("cannot hash the body for aws-sigv4: %w", err)
+		}
+		payloadHash = hex.EncodeToString(sum)
+	case service == "s3":
+		payloadHash = sigV4UnsignedPayload
+	default:
+		return fmt.Errorf("-auth-type aws-sigv4 can't sign a streamed body from stdin or a pipe for %s, only for s3", service)
+	}
+	signSigV4(r.Request, payloadHash, creds, region, service, time.Now())
+	return nil
+}
+
+// signSigV4 sets the X-Amz-Date and Authorization headers of req, and the
+// X-Amz-Security-Token if there is a session token, signed with the
+// credentials for the service in region at the time t. payloadHash is the
+// hex-encoded SHA-256 of the body.
+func signSigV4(req *http.Request, payloadHash string, creds awsCredentials, region, service string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	// S3 requires the hash of the body in a header.
+	if service == "s3" {
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	headers, signedHeaders := sigV4Headers(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		sigV4Path(req.URL, service),
+		sigV4Query(req.URL.RawQuery),
+		headers,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		amzDate,
+		scope,
+		hashHex([]byte(canonicalRequest)),
+	}, "\n")
+	key := hmacSHA256([]byte("AWS4"+creds.secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		sigV4Algorithm, creds.accessKey, scope, signedHeaders, signature))
+}
+
+// sigV4Path return the canonical URI of u. The path is normalized and encoded
+// twice, except for S3 which uses it as is, encoded once.
+func sigV4Path(u *url.URL, service string) string {
+	p := u.Path
+	if p == "" {
+		p = "/"
+	}
+	if service == "s3" {
+		return uriEncode(p, false)
+	}
+	clean := path.Clean(p)
+	if strings.HasSuffix(p, "/") && clean != "/" {
+		clean += "/"
+	}
+	return uriEncode(uriEncode(clean, false), false)
+}
+
+// sigV4Query return the canonical query string of rawQuery, the parameters
+// sorted by name and value and encoded with %20 for the spaces.
+func sigV4Query(rawQuery string) string {
+	if rawQuery == "" {
+		return ""
+	}
+	var params []string
+	for _, pair := range strings.Split(rawQuery, "&") {
+		if pair == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(pair, "=")
+		if uk, err := url.QueryUnescape(k); err == nil {
+			k = uk
+		}
+		if uv, err := url.QueryUnescape(v); err == nil {
+			v = uv
+		}
+		params = append(params, uriEncode(k, true)+"="+uriEncode(v, true))
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+// sigV4Headers return the canonical headers of req and the list of the signed
+// headers, which are the Host and all the headers except [sigV4Unsigned].
+func sigV4Headers(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	values := map[string]string{"host": host}
+	for k, vs := range req.Header {
+		if sigV4Unsigned[http.CanonicalHeaderKey(k)] {
+			continue
+		}
+		trimmed := make([]string, len(vs))
+		for i, v := range vs {
+			trimmed[i] = strings.Join(strings.Fields(v), " ")
+		}
+		values[strings.ToLower(k)] = strings.Join(trimmed, ",")
+	}
+	names := make([]string, 0, len(values))
+	for k := range values {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, k := range names {
+		b.WriteString(k + ":" + values[k] + "\n")
+	}
+	return b.String(), strings.Join(names, ";")
+}
+
+// uriEncode percent-encode s as AWS requires, all the bytes except the
+// unreserved characters, and the slashes too if encodeSlash is true.
+func uriEncode(s string, encodeSlash bool) string {
+	const hexDigits = "0123456789ABCDEF"
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteByte('%')
+			b.WriteByte(hexDigits[c>>4])
+			b.WriteByte(hexDigits[c&15])
+		}
+	}
+	return b.String()
+}
+
+// hashHex return the hex-encoded SHA-256 of b.
+func hashHex(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// hmacSHA256 return the HMAC-SHA256 of data with key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
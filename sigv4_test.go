@@ -0,0 +1,354 @@
+package ihttp
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestSignSigV4 uses the AWS Signature Version 4 test suite, whose requests are
+// signed with the credentials AKIDEXAMPLE for the service `service` in
+// us-east-1 at 20150830T123600Z. The cases with spaces or UTF-8 in the path
+// are left out, the suite encodes them once but the services other than S3
+// encode the path twice, as the AWS SDKs do.
+func TestSignSigV4(t *testing.T) {
+	creds := awsCredentials{accessKey: "AKIDEXAMPLE", secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	date := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+	tt := []struct {
+		name          string
+		method        string
+		url           string
+		header        http.Header
+		body          string
+		signedHeaders string
+		signature     string
+	}{
+		{
+			name:          "get-vanilla",
+			method:        http.MethodGet,
+			url:           "https://example.amazonaws.com/",
+			signedHeaders: "host;x-amz-date",
+			signature:     "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:          "get-vanilla-query-order-key-case",
+			method:        http.MethodGet,
+			url:           "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			signedHeaders: "host;x-amz-date",
+			signature:     "b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		{
+			name:          "get-vanilla-empty-query-key",
+			method:        http.MethodGet,
+			url:           "https://example.amazonaws.com/?Param1=value1",
+			signedHeaders: "host;x-amz-date",
+			signature:     "a67d582fa61cc504c4bae71f336f98b97f1ea3c7a6bfe1b6e45aec72011b9aeb",
+		},
+		{
+			name:          "get-vanilla-utf8-query",
+			method:        http.MethodGet,
+			url:           "https://example.amazonaws.com/?%E1%88%B4=bar",
+			signedHeaders: "host;x-amz-date",
+			signature:     "2cdec8eed098649ff3a119c94853b13c643bcf08f8b0a1d91e12c9027818dd04",
+		},
+		{
+			name:          "get-relative-relative",
+			method:        http.MethodGet,
+			url:           "https://example.amazonaws.com/example1/example2/../..",
+			signedHeaders: "host;x-amz-date",
+			signature:     "5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		{
+			name:          "get-header-value-trim",
+			method:        http.MethodGet,
+			url:           "https://example.amazonaws.com/",
+			header:        http.Header{"My-Header1": {" value1"}, "My-Header2": {` "a   b   c"`}},
+			signedHeaders: "host;my-header1;my-header2;x-amz-date",
+			signature:     "acc3ed3afb60bb290fc8d2dd0098b9911fcaa05412b367055dee359757a9c736",
+		},
+		{
+			name:          "post-vanilla",
+			method:        http.MethodPost,
+			url:           "https://example.amazonaws.com/",
+			signedHeaders: "host;x-amz-date",
+			signature:     "5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		{
+			name:          "post-header-key-sort",
+			method:        http.MethodPost,
+			url:           "https://example.amazonaws.com/",
+			header:        http.Header{"My-Header1": {"value1"}},
+			signedHeaders: "host;my-header1;x-amz-date",
+			signature:     "c5410059b04c1ee005303aed430f6e6645f61f4dc9e1461ec8f8916fdf18852c",
+		},
+		{
+			name:          "post-x-www-form-urlencoded",
+			method:        http.MethodPost,
+			url:           "https://example.amazonaws.com/",
+			header:        http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			body:          "Param1=value1",
+			signedHeaders: "content-type;host;x-amz-date",
+			signature:     "ff11897932ad3f4e8b18135d722051e5ac45fc38421b1da7b9d196a0fe09473a",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tc.header {
+				req.Header[k] = v
+			}
+			signSigV4(req, hashHex([]byte(tc.body)), creds, "us-east-1", "service", date)
+			want := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=" + tc.signedHeaders + ", Signature=" + tc.signature
+			if got := req.Header.Get("Authorization"); got != want {
+				t.Errorf("\nwant\t%s\ngot\t%s", want, got)
+			}
+			if got := req.Header.Get("X-Amz-Date"); got != "20150830T123600Z" {
+				t.Errorf("X-Amz-Date: got %q", got)
+			}
+		})
+	}
+}
+
+func TestLoadAWSCredentials(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "credentials")
+	err := os.WriteFile(file, []byte(`[default]
+aws_access_key_id = AKIDDEFAULT
+aws_secret_access_key = defaultsecret
+
+# MinIO running locally.
+[minio]
+aws_access_key_id=minioadmin
+aws_secret_access_key=minioadmin
+aws_session_token=token
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tt := []struct {
+		name    string
+		auth    string
+		env     map[string]string
+		want    awsCredentials
+		wantErr bool
+	}{
+		{
+			name: "auth",
+			auth: "AKIDAUTH:authsecret",
+			env:  map[string]string{"AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "envsecret"},
+			want: awsCredentials{accessKey: "AKIDAUTH", secretKey: "authsecret"},
+		},
+		{
+			name: "environment",
+			env:  map[string]string{"AWS_ACCESS_KEY_ID": "AKIDENV", "AWS_SECRET_ACCESS_KEY": "envsecret", "AWS_SESSION_TOKEN": "envtoken"},
+			want: awsCredentials{accessKey: "AKIDENV", secretKey: "envsecret", sessionToken: "envtoken"},
+		},
+		{
+			name: "default profile",
+			env:  map[string]string{"AWS_SHARED_CREDENTIALS_FILE": file},
+			want: awsCredentials{accessKey: "AKIDDEFAULT", secretKey: "defaultsecret"},
+		},
+		{
+			name: "profile",
+			env:  map[string]string{"AWS_SHARED_CREDENTIALS_FILE": file, "AWS_PROFILE": "minio"},
+			want: awsCredentials{accessKey: "minioadmin", secretKey: "minioadmin", sessionToken: "token"},
+		},
+		{
+			name:    "unknown profile",
+			env:     map[string]string{"AWS_SHARED_CREDENTIALS_FILE": file, "AWS_PROFILE": "prod"},
+			wantErr: true,
+		},
+		{
+			name:    "no credentials file",
+			env:     map[string]string{"AWS_SHARED_CREDENTIALS_FILE": filepath.Join(dir, "missing")},
+			wantErr: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, k := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_SHARED_CREDENTIALS_FILE"} {
+				t.Setenv(k, tc.env[k])
+			}
+			got, err := loadAWSCredentials(tc.auth)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatalf("expected error, got %#v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tc.want {
+				t.Errorf("\nwant\t%#v\ngot\t%#v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestAWSSigV4Request(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	tt := []struct {
+		name     string
+		method   string
+		url      string
+		netrc    string
+		opts     Options
+		bodyType BodyType
+		items    []item
+		stdin    string
+		scope    string
+		wantSHA  bool
+		unsigned bool
+		wantErr  bool
+	}{
+		{
+			name:     "s3",
+			method:   http.MethodPut,
+			url:      "http://localhost:9000/bucket/key",
+			opts:     Options{AuthType: AuthAWSSigV4, AWSRegion: "us-east-1", AWSService: "s3"},
+			bodyType: JSONBody,
+			items:    []item{{Key: "name", Val: "ihttp", Sep: SepDataString}},
+			scope:    "/us-east-1/s3/aws4_request",
+			wantSHA:  true,
+		},
+		{
+			name:     "streamed multipart",
+			method:   http.MethodPost,
+			url:      "https://abc123.execute-api.eu-west-1.amazonaws.com/prod/upload",
+			opts:     Options{AuthType: AuthAWSSigV4, Multipart: true},
+			bodyType: MultipartBody,
+			items: []item{
+				{Key: "name", Val: "ihttp", Sep: SepDataString},
+				{Key: "file", Val: "examples/plain.txt", Sep: SepFileUpload},
+			},
+			scope: "/eu-west-1/execute-api/aws4_request",
+		},
+		{
+			name:     "chunked stdin s3",
+			method:   http.MethodPut,
+			url:      "http://localhost:9000/bucket/key",
+			opts:     Options{AuthType: AuthAWSSigV4, AWSRegion: "us-east-1", AWSService: "s3", Chunked: true},
+			bodyType: RawBody,
+			stdin:    "lorem ipsum",
+			scope:    "/us-east-1/s3/aws4_request",
+			wantSHA:  true,
+			unsigned: true,
+		},
+		{
+			name:     "chunked stdin other service",
+			method:   http.MethodPost,
+			url:      "https://abc123.execute-api.eu-west-1.amazonaws.com/prod/items",
+			opts:     Options{AuthType: AuthAWSSigV4, Chunked: true},
+			bodyType: RawBody,
+			stdin:    "lorem ipsum",
+			wantErr:  true,
+		},
+		{
+			name:  "region and service from the host",
+			url:   "https://abc123.execute-api.eu-west-1.amazonaws.com/prod/items",
+			opts:  Options{AuthType: AuthAWSSigV4},
+			scope: "/eu-west-1/execute-api/aws4_request",
+		},
+		{
+			name:    "netrc entry for the host",
+			url:     "http://localhost:9000/bucket",
+			netrc:   "machine localhost login alice password s3cret",
+			opts:    Options{AuthType: AuthAWSSigV4, AWSRegion: "us-east-1", AWSService: "s3"},
+			scope:   "/us-east-1/s3/aws4_request",
+			wantSHA: true,
+		},
+		{
+			name:    "no region",
+			url:     "http://localhost:9000/bucket",
+			opts:    Options{AuthType: AuthAWSSigV4},
+			wantErr: true,
+		},
+		{
+			name:  "authorization item wins",
+			url:   "http://localhost:9000/bucket",
+			opts:  Options{AuthType: AuthAWSSigV4, AWSRegion: "us-east-1", AWSService: "s3"},
+			items: []item{{Key: "Authorization", Val: "Token abc", Sep: SepHeader}},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			setNetrc(t, tc.netrc)
+			in := &Input{Options: tc.opts, Method: http.MethodGet, URL: tc.url, Items: tc.items, BodyType: tc.bodyType}
+			if tc.method != "" {
+				in.Method = tc.method
+			}
+			if tc.stdin != "" {
+				in.stdin = strings.NewReader(tc.stdin)
+			}
+			req, _, err := NewRequest(in)
+			if tc.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			auth := req.Header.Get("Authorization")
+			if tc.scope == "" {
+				if auth != "Token abc" || req.Header.Get("X-Amz-Date") != "" {
+					t.Errorf("the request is signed: %q", auth)
+				}
+				return
+			}
+			date := req.Header.Get("X-Amz-Date")
+			if len(date) < 8 {
+				t.Fatalf("the request isn't signed: %q", auth)
+			}
+			wantCred := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/" + date[:8] + tc.scope
+			if !strings.HasPrefix(auth, wantCred) {
+				t.Errorf("\nwant\t%s...\ngot\t%s", wantCred, auth)
+			}
+
+			// The payload hash is the one of the body that is sent.
+			payloadHash := sigV4UnsignedPayload
+			if !tc.unsigned {
+				var body []byte
+				if req.GetBody != nil {
+					rc, err := req.GetBody()
+					if err != nil {
+						t.Fatal(err)
+					}
+					body, err = io.ReadAll(rc)
+					rc.Close()
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				payloadHash = hashHex(body)
+			}
+			gotSHA := req.Header.Get("X-Amz-Content-Sha256")
+			if tc.wantSHA && gotSHA != payloadHash || !tc.wantSHA && gotSHA != "" {
+				t.Errorf("X-Amz-Content-Sha256: got %q, want %q", gotSHA, payloadHash)
+			}
+			signedAt, err := time.Parse("20060102T150405Z", date)
+			if err != nil {
+				t.Fatal(err)
+			}
+			scope := strings.Split(tc.scope, "/")
+			want := req.Clone(req.Context())
+			creds := awsCredentials{accessKey: "AKIDEXAMPLE", secretKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+			signSigV4(want, payloadHash, creds, scope[1], scope[2], signedAt)
+			if wantAuth := want.Header.Get("Authorization"); auth != wantAuth {
+				t.Errorf("\nwant\t%s\ngot\t%s", wantAuth, auth)
+			}
+		})
+	}
+}
@@ -0,0 +1,301 @@
+package ihttp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// SOCKS version 5 protocol values (RFC 1928 and RFC 1929).
+const (
+	socksVersion = 0x05
+
+	socksAuthNone         = 0x00
+	socksAuthPassword     = 0x02
+	socksAuthNoAcceptable = 0xff
+	socksAuthVersion      = 0x01 // username/password sub-negotiation
+
+	socksCmdConnect = 0x01
+
+	socksAddrIPv4   = 0x01
+	socksAddrDomain = 0x03
+	socksAddrIPv6   = 0x04
+)
+
+// socksReplies are the messages for the reply codes of a SOCKS server.
+var socksReplies = map[byte]string{
+	0x01: "general SOCKS server failure",
+	0x02: "connection not allowed by ruleset",
+	0x03: "network unreachable",
+	0x04: "host unreachable",
+	0x05: "connection refused",
+	0x06: "TTL expired",
+	0x07: "command not supported",
+	0x08: "address type not supported",
+}
+
+// isSocks returns true if u is the URL of a SOCKS5 proxy.
+func isSocks(u *url.URL) bool {
+	return u.Scheme == "socks5" || u.Scheme == "socks5h"
+}
+
+// socksTransport return a RoundTripper that sends the requests through the
+// SOCKS5 proxies in proxies (which maps a URL scheme to the URL of a proxy),
+// and the other requests through t. If there isn't any SOCKS5 proxy return t.
+func socksTransport(t *http.Transport, proxies map[string]string) (http.RoundTripper, error) {
+	st := schemeTransport{fallback: t, byScheme: map[string]http.RoundTripper{}}
+	for scheme, rawURL := range proxies {
+		u, err := parseProxyURL(rawURL)
+		if err != nil {
+			return nil, err
+		}
+		if !isSocks(u) {
+			continue
+		}
+		c := t.Clone()
+		c.Proxy = nil
+		c.DialContext = newSocksDialer(u, t.DialContext).DialContext
+		st.byScheme[scheme] = c
+	}
+	if len(st.byScheme) == 0 {
+		return t, nil
+	}
+	return st, nil
+}
+
+// schemeTransport is a RoundTripper that sends each request with the
+// RoundTripper of the scheme of its URL, or with fallback.
+type schemeTransport struct {
+	fallback http.RoundTripper
+	byScheme map[string]http.RoundTripper
+}
+
+func (st schemeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if rt, ok := st.byScheme[req.URL.Scheme]; ok {
+		return rt.RoundTrip(req)
+	}
+	return st.fallback.RoundTrip(req)
+}
+
+// socksDialer connects to the addresses through a SOCKS5 proxy.
+type socksDialer struct {
+	// proxyAddr is the host:port of the proxy.
+	proxyAddr string
+
+	// user and password for the username/password authentication, used
+	// only if hasAuth is true.
+	user     string
+	password string
+	hasAuth  bool
+
+	// remoteDNS sends the host names to the proxy to be resolved there
+	// (socks5h://), otherwise they are resolved locally (socks5://).
+	remoteDNS bool
+
+	// dial connects to the proxy.
+	dial func(ctx context.Context, network, addr string) (net.Conn, error)
+}
+
+// newSocksDialer return a socksDialer for the proxy URL u, with the scheme
+// socks5 or socks5h, which connects to the proxy with dial.
+func newSocksDialer(u *url.URL, dial func(ctx context.Context, network, addr string) (net.Conn, error)) *socksDialer {
+	d := &socksDialer{
+		proxyAddr: u.Host,
+		remoteDNS: u.Scheme == "socks5h",
+		dial:      dial,
+	}
+	if u.Port() == "" {
+		d.proxyAddr = net.JoinHostPort(u.Hostname(), "1080")
+	}
+	if u.User != nil {
+		d.hasAuth = true
+		d.user = u.User.Username()
+		d.password, _ = u.User.Password()
+	}
+	return d
+}
+
+// DialContext connects to addr through the proxy, only the tcp networks are
+// supported.
+func (d *socksDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("socks5: unsupported network %q", network)
+	}
+	conn, err := d.dial(ctx, "tcp", d.proxyAddr)
+	if err != nil {
+		return nil, fmt.Errorf("socks5: cannot connect to the proxy %s: %w", d.proxyAddr, err)
+	}
+
+	// The handshake honours the deadline and the cancellation of ctx.
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Unix(1, 0))
+	})
+	err = d.handshake(ctx, conn, addr)
+	if !stop() && err == nil {
+		err = ctx.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	return conn, nil
+}
+
+// handshake negotiate the authentication method with the proxy on conn and ask
+// it to connect to addr.
+func (d *socksDialer) handshake(ctx context.Context, conn net.Conn, addr string) error {
+	methods := []byte{socksAuthNone}
+	if d.hasAuth {
+		methods = []byte{socksAuthNone, socksAuthPassword}
+	}
+	greeting := append([]byte{socksVersion, byte(len(methods))}, methods...)
+	if _, err := conn.Write(greeting); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	var resp [2]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	if resp[0] != socksVersion {
+		return fmt.Errorf("socks5: unexpected protocol version %d", resp[0])
+	}
+	switch resp[1] {
+	case socksAuthNone:
+	case socksAuthPassword:
+		if !d.hasAuth {
+			return errors.New("socks5: the proxy requires authentication")
+		}
+		if err := d.authenticate(conn); err != nil {
+			return err
+		}
+	case socksAuthNoAcceptable:
+		return errors.New("socks5: no acceptable authentication methods")
+	default:
+		return fmt.Errorf("socks5: unsupported authentication method %d", resp[1])
+	}
+	req, err := d.connectRequest(ctx, addr)
+	if err != nil {
+		return err
+	}
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	return readSocksReply(conn)
+}
+
+// authenticate with the username/password method (RFC 1929).
+func (d *socksDialer) authenticate(conn net.Conn) error {
+	if len(d.user) == 0 || len(d.user) > 255 || len(d.password) > 255 {
+		return errors.New("socks5: the username and password must be from 1 to 255 bytes")
+	}
+	req := []byte{socksAuthVersion, byte(len(d.user))}
+	req = append(req, d.user...)
+	req = append(req, byte(len(d.password)))
+	req = append(req, d.password...)
+	if _, err := conn.Write(req); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	var resp [2]byte
+	if _, err := io.ReadFull(conn, resp[:]); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	if resp[1] != 0x00 {
+		return errors.New("socks5: authentication failed")
+	}
+	return nil
+}
+
+// connectRequest return the CONNECT request for addr. A host name is sent as is
+// with remoteDNS, otherwise it's resolved to an IP address, preferably IPv4.
+func (d *socksDialer) connectRequest(ctx context.Context, addr string) ([]byte, error) {
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("socks5: %w", err)
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("socks5: invalid port %q", portStr)
+	}
+	req := []byte{socksVersion, socksCmdConnect, 0x00}
+	ip := net.ParseIP(host)
+	if ip == nil && !d.remoteDNS {
+		ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+		if err != nil {
+			return nil, fmt.Errorf("socks5: %w", err)
+		}
+		ip = ips[0]
+		for _, i := range ips {
+			if i.To4() != nil {
+				ip = i
+				break
+			}
+		}
+	}
+	switch {
+	case ip == nil:
+		if len(host) > 255 {
+			return nil, fmt.Errorf("socks5: host name too long: %s", host)
+		}
+		req = append(req, socksAddrDomain, byte(len(host)))
+		req = append(req, host...)
+	case ip.To4() != nil:
+		req = append(req, socksAddrIPv4)
+		req = append(req, ip.To4()...)
+	default:
+		req = append(req, socksAddrIPv6)
+		req = append(req, ip.To16()...)
+	}
+	return append(req, byte(port>>8), byte(port)), nil
+}
+
+// readSocksReply read the reply of the proxy to a CONNECT request, including
+// the bound address which isn't used.
+func readSocksReply(conn net.Conn) error {
+	var head [4]byte
+	if _, err := io.ReadFull(conn, head[:]); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	if head[0] != socksVersion {
+		return fmt.Errorf("socks5: unexpected protocol version %d", head[0])
+	}
+	if head[1] != 0x00 {
+		msg, ok := socksReplies[head[1]]
+		if !ok {
+			msg = fmt.Sprintf("unknown reply code %d", head[1])
+		}
+		return fmt.Errorf("socks5: %s", msg)
+	}
+	var n int
+	switch head[3] {
+	case socksAddrIPv4:
+		n = net.IPv4len
+	case socksAddrIPv6:
+		n = net.IPv6len
+	case socksAddrDomain:
+		var l [1]byte
+		if _, err := io.ReadFull(conn, l[:]); err != nil {
+			return fmt.Errorf("socks5: %w", err)
+		}
+		n = int(l[0])
+	default:
+		return fmt.Errorf("socks5: unknown address type %d", head[3])
+	}
+
+	// Bound address and port.
+	if _, err := io.CopyN(io.Discard, conn, int64(n+2)); err != nil {
+		return fmt.Errorf("socks5: %w", err)
+	}
+	return nil
+}
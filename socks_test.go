@@ -0,0 +1,178 @@
+package ihttp
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// socksServer is a minimal SOCKS5 proxy for the tests, it requires the
+// credentials user:pass if auth is true and records the address type of the
+// last CONNECT request.
+type socksServer struct {
+	ln       net.Listener
+	auth     bool
+	addrType atomic.Int32
+}
+
+func newSocksServer(t *testing.T, auth bool) *socksServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &socksServer{ln: ln, auth: auth}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *socksServer) serve(conn net.Conn) {
+	defer conn.Close()
+	head := make([]byte, 2)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return
+	}
+	methods := make([]byte, head[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return
+	}
+	method := byte(socksAuthNone)
+	if s.auth {
+		method = socksAuthNoAcceptable
+		if strings.ContainsRune(string(methods), socksAuthPassword) {
+			method = socksAuthPassword
+		}
+	}
+	conn.Write([]byte{socksVersion, method})
+	switch method {
+	case socksAuthNoAcceptable:
+		return
+	case socksAuthPassword:
+		buf := make([]byte, 513)
+		io.ReadFull(conn, buf[:2])
+		user := make([]byte, buf[1])
+		io.ReadFull(conn, user)
+		io.ReadFull(conn, buf[:1])
+		pass := make([]byte, buf[0])
+		io.ReadFull(conn, pass)
+		if string(user) != "user" || string(pass) != "pass" {
+			conn.Write([]byte{socksAuthVersion, 0x01})
+			return
+		}
+		conn.Write([]byte{socksAuthVersion, 0x00})
+	}
+	req := make([]byte, 4)
+	if _, err := io.ReadFull(conn, req); err != nil {
+		return
+	}
+	s.addrType.Store(int32(req[3]))
+	var host string
+	switch req[3] {
+	case socksAddrIPv4:
+		ip := make([]byte, net.IPv4len)
+		io.ReadFull(conn, ip)
+		host = net.IP(ip).String()
+	case socksAddrDomain:
+		l := make([]byte, 1)
+		io.ReadFull(conn, l)
+		name := make([]byte, l[0])
+		io.ReadFull(conn, name)
+		host = string(name)
+	default:
+		conn.Write([]byte{socksVersion, 0x08, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	port := make([]byte, 2)
+	io.ReadFull(conn, port)
+	addr := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	dst, err := net.Dial("tcp4", addr)
+	if err != nil {
+		conn.Write([]byte{socksVersion, 0x05, 0x00, socksAddrIPv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	defer dst.Close()
+	conn.Write([]byte{socksVersion, 0x00, 0x00, socksAddrIPv4, 127, 0, 0, 1, 0, 0})
+	go io.Copy(dst, conn)
+	io.Copy(conn, dst)
+}
+
+func TestSocksProxy(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer target.Close()
+	_, port, _ := net.SplitHostPort(target.Listener.Addr().String())
+	withAuth := newSocksServer(t, true)
+	noAuth := newSocksServer(t, false)
+	tt := []struct {
+		name         string
+		proxy        string
+		wantAddrType byte
+		errExpected  bool
+	}{
+		{
+			name:         "socks5 resolves locally",
+			proxy:        "socks5://" + noAuth.ln.Addr().String(),
+			wantAddrType: socksAddrIPv4,
+		},
+		{
+			name:         "socks5h resolves remotely",
+			proxy:        "socks5h://" + noAuth.ln.Addr().String(),
+			wantAddrType: socksAddrDomain,
+		},
+		{
+			name:         "username and password",
+			proxy:        "socks5h://user:pass@" + withAuth.ln.Addr().String(),
+			wantAddrType: socksAddrDomain,
+		},
+		{
+			name:        "wrong password",
+			proxy:       "socks5h://user:nope@" + withAuth.ln.Addr().String(),
+			errExpected: true,
+		},
+		{
+			name:        "missing credentials",
+			proxy:       "socks5h://" + withAuth.ln.Addr().String(),
+			errExpected: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, "http://localhost:"+port, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := Options{Proxy: map[string]string{"http": tc.proxy}}
+			out, err := NewOutput(req, nil, opts)
+			if (err != nil) != tc.errExpected {
+				t.Fatalf("%s: unexpected error status: %v", tc.name, err)
+			}
+			if tc.errExpected {
+				return
+			}
+			if !strings.HasSuffix(out.String(), "\nhello") {
+				t.Errorf("unexpected output %q", out.String())
+			}
+			for _, s := range []*socksServer{withAuth, noAuth} {
+				if strings.HasSuffix(tc.proxy, s.ln.Addr().String()) && byte(s.addrType.Load()) != tc.wantAddrType {
+					t.Errorf("want address type %d, got %d", tc.wantAddrType, s.addrType.Load())
+				}
+			}
+		})
+	}
+}
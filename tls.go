@@ -0,0 +1,310 @@
+package ihttp
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+)
+
+// tlsVersions maps the values of Options.SSL to the TLS versions.
+var tlsVersions = map[string]uint16{
+	"tls1":   tls.VersionTLS10,
+	"tls1.1": tls.VersionTLS11,
+	"tls1.2": tls.VersionTLS12,
+	"tls1.3": tls.VersionTLS13,
+}
+
+// newTLSConfig return the TLS configuration of the transport from the values
+// of opts, hooks.onClientCert is called when the client certificate is sent.
+func newTLSConfig(opts Options, hooks clientHooks) (*tls.Config, error) {
+	cfg := &tls.Config{}
+	switch strings.ToLower(opts.Verify) {
+	case "", "yes", "true":
+	case "no", "false":
+		cfg.InsecureSkipVerify = true
+	default:
+		pool, err := loadCABundle(opts.Verify)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+	if opts.SSL != "" {
+		v, err := parseTLSVersion(opts.SSL)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MinVersion = v
+	}
+	if opts.Ciphers != "" {
+		ids, err := parseCipherSuites(opts.Ciphers)
+		if err != nil {
+			return nil, err
+		}
+		cfg.CipherSuites = ids
+	}
+	if len(opts.Pins) > 0 {
+		pins, err := parsePins(opts.Pins)
+		if err != nil {
+			return nil, err
+		}
+		cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+			return verifyPins(cs, pins)
+		}
+	}
+	if opts.TLSKeyLog != "" {
+		w, err := newKeyLogWriter(opts.TLSKeyLog)
+		if err != nil {
+			return nil, err
+		}
+		cfg.KeyLogWriter = w
+	}
+	if opts.Cert != "" {
+		cert, err := loadClientCert(opts.Cert, opts.CertKey, opts.CertKeyPass)
+		if err != nil {
+			return nil, err
+		}
+
+		// The certificate is sent whenever the server asks for one, even
+		// if it isn't signed by one of the CAs the server accepts, and so
+		// the server can tell why it's rejected.
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if hooks.onClientCert != nil {
+				hooks.onClientCert(cert.Leaf)
+			}
+			return cert, nil
+		}
+	}
+	return cfg, nil
+}
+
+// PinError is returned when none of the certificates of the server matches
+// the pinned public keys of Options.Pins.
+type PinError struct {
+	// Host is the server name of the TLS connection, or the host of the URL
+	// if it's an IP address, which isn't sent as server name.
+	Host string
+
+	// Pins are the hashes of the public keys of the certificates that were
+	// checked, in the same form of Options.Pins.
+	Pins []string
+}
+
+func (e *PinError) Error() string {
+	return fmt.Sprintf("public key pinning failed for %s: no certificate matches the pinned keys (the server sent %s)", e.Host, strings.Join(e.Pins, ", "))
+}
+
+// parsePins return the SHA-256 hashes of the public keys of pins, in the form
+// `sha256//<base64 hash>`.
+func parsePins(pins []string) (map[[sha256.Size]byte]bool, error) {
+	hashes := make(map[[sha256.Size]byte]bool, len(pins))
+	for _, pin := range pins {
+		b64, ok := strings.CutPrefix(pin, "sha256//")
+		if !ok {
+			return nil, fmt.Errorf("invalid -pin %q (expected sha256//<base64 hash>)", pin)
+		}
+		b, err := base64.StdEncoding.DecodeString(b64)
+		if err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("invalid -pin %q: not a base64-encoded SHA-256 hash", pin)
+		}
+		hashes[[sha256.Size]byte(b)] = true
+	}
+	return hashes, nil
+}
+
+// verifyPins check that a certificate of the verified chains of the server in
+// cs has a public key whose hash is in pins. The certificates sent by the
+// server aren't checked, anyone can send a public intermediate certificate. If
+// the verification of the certificate is skipped, only the leaf is checked.
+func verifyPins(cs tls.ConnectionState, pins map[[sha256.Size]byte]bool) error {
+	var certs []*x509.Certificate
+	for _, chain := range cs.VerifiedChains {
+		certs = append(certs, chain...)
+	}
+	if len(cs.VerifiedChains) == 0 && len(cs.PeerCertificates) > 0 {
+		certs = cs.PeerCertificates[:1]
+	}
+	var got []string
+	for _, c := range certs {
+		sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+		if pins[sum] {
+			return nil
+		}
+		pin := "sha256//" + base64.StdEncoding.EncodeToString(sum[:])
+		if !slices.Contains(got, pin) {
+			got = append(got, pin)
+		}
+	}
+	return &PinError{Host: cs.ServerName, Pins: got}
+}
+
+// setPinErrorHost sets the Host of the PinError in err, if any and without a
+// server name, to the host of the URL of the request that failed.
+func setPinErrorHost(err error) {
+	var pinErr *PinError
+	var urlErr *url.Error
+	if !errors.As(err, &pinErr) || pinErr.Host != "" || !errors.As(err, &urlErr) {
+		return
+	}
+	if u, err := url.Parse(urlErr.URL); err == nil {
+		pinErr.Host = u.Hostname()
+	}
+}
+
+// keyLogWriter appends the TLS secrets in the NSS key log format to the file at
+// its path, opening it for each write so that it isn't kept open.
+type keyLogWriter string
+
+// newKeyLogWriter return a keyLogWriter for the file at path, which is created
+// with read and write permissions only for the owner if it doesn't exist.
+func newKeyLogWriter(path string) (keyLogWriter, error) {
+	path, err := expandHome(path)
+	if err != nil {
+		return "", err
+	}
+	w := keyLogWriter(path)
+	f, err := w.open()
+	if err != nil {
+		return "", fmt.Errorf("cannot open the TLS key log file (-tls-keylog): %w", err)
+	}
+	return w, f.Close()
+}
+
+func (w keyLogWriter) open() (*os.File, error) {
+	return os.OpenFile(string(w), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+}
+
+func (w keyLogWriter) Write(p []byte) (int, error) {
+	f, err := w.open()
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return f.Write(p)
+}
+
+// loadClientCert load the client certificate from the PEM file certFile, and
+// its private key from the PEM file keyFile or from certFile if keyFile is
+// empty. An encrypted key is decrypted with passphrase, which is asked in the
+// terminal if it's empty.
+func loadClientCert(certFile, keyFile, passphrase string) (*tls.Certificate, error) {
+	certFile, err := expandHome(certFile)
+	if err != nil {
+		return nil, err
+	}
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the client certificate (-cert): %w", err)
+	}
+	keyPEM := certPEM
+	if keyFile != "" {
+		keyFile, err = expandHome(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		keyPEM, err = os.ReadFile(keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read the private key (-cert-key): %w", err)
+		}
+	}
+	key := findKeyBlock(keyPEM)
+	if key == nil {
+		if keyFile == "" {
+			return nil, fmt.Errorf("no private key found in %q, use -cert-key to set its file", certFile)
+		}
+		return nil, fmt.Errorf("no private key found in %q", keyFile)
+	}
+	if isEncryptedKey(key) {
+		if passphrase == "" {
+			passphrase, err = promptPassword("Passphrase for the private key: ")
+			if err != nil {
+				return nil, err
+			}
+		}
+		key, err = decryptKey(key, passphrase)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cert, err := tls.X509KeyPair(certPEM, pem.EncodeToMemory(key))
+	if err != nil {
+		return nil, fmt.Errorf("invalid client certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// findKeyBlock return the first PEM block of a private key in b, or nil if
+// there isn't any.
+func findKeyBlock(b []byte) *pem.Block {
+	for {
+		var block *pem.Block
+		block, b = pem.Decode(b)
+		if block == nil {
+			return nil
+		}
+		if block.Type == "PRIVATE KEY" || strings.HasSuffix(block.Type, " PRIVATE KEY") {
+			return block
+		}
+	}
+}
+
+// loadCABundle return a pool with the CA certificates of the PEM file at path,
+// used instead of the system ones.
+func loadCABundle(path string) (*x509.CertPool, error) {
+	path, err := expandHome(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the CA bundle (-verify): %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("no PEM certificates found in the CA bundle %q", path)
+	}
+	return pool, nil
+}
+
+// parseTLSVersion return the TLS version for the value s of -ssl.
+func parseTLSVersion(s string) (uint16, error) {
+	v, ok := tlsVersions[strings.ToLower(s)]
+	if !ok {
+		return 0, fmt.Errorf("invalid -ssl value %q (expected tls1, tls1.1, tls1.2 or tls1.3)", s)
+	}
+	return v, nil
+}
+
+// parseCipherSuites return the IDs of the cipher suites named in s, separated
+// by commas or colons, e.g. `TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256`. The TLS 1.3
+// cipher suites aren't configurable.
+func parseCipherSuites(s string) ([]uint16, error) {
+	suites := append(tls.CipherSuites(), tls.InsecureCipherSuites()...)
+	var ids []uint16
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ':' }) {
+		name = strings.TrimSpace(name)
+		var found bool
+		for _, cs := range suites {
+			if strings.EqualFold(cs.Name, name) {
+				ids = append(ids, cs.ID)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown cipher suite %q (-ciphers)", name)
+		}
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("invalid -ciphers value %q", s)
+	}
+	return ids, nil
+}
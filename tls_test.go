@@ -0,0 +1,495 @@
+package ihttp
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeCertPEM write the certificate of srv as a PEM file in a temporary
+// directory and return its path.
+func writeCertPEM(t *testing.T, srv *httptest.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ca.pem")
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestTLSVerify(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	srv.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+	ca := writeCertPEM(t, srv)
+	tt := []struct {
+		name            string
+		opts            Options
+		wantErrContains string
+	}{
+		{
+			name:            "default verify",
+			opts:            Options{},
+			wantErrContains: "certificate",
+		},
+		{
+			name: "verify no",
+			opts: Options{Verify: "no"},
+		},
+		{
+			name: "verify CA bundle",
+			opts: Options{Verify: ca},
+		},
+		{
+			name:            "missing CA bundle",
+			opts:            Options{Verify: "examples/missing.pem"},
+			wantErrContains: "cannot read the CA bundle",
+		},
+		{
+			name:            "invalid CA bundle",
+			opts:            Options{Verify: "examples/plain.txt"},
+			wantErrContains: "no PEM certificates found",
+		},
+		{
+			name: "minimum version",
+			opts: Options{Verify: ca, SSL: "tls1.2"},
+		},
+		{
+			name:            "minimum version not supported by the server",
+			opts:            Options{Verify: ca, SSL: "tls1.3"},
+			wantErrContains: "protocol version",
+		},
+		{
+			name: "cipher suites",
+			opts: Options{Verify: ca, Ciphers: "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384"},
+		},
+		{
+			name:            "cipher suites not supported by the server",
+			opts:            Options{Verify: ca, Ciphers: "TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256"},
+			wantErrContains: "handshake failure",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out, err := NewOutput(req, nil, tc.opts)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("\ngot\t%v\nwant\t%#q", err, tc.wantErrContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(out.String(), "\nhello") {
+				t.Errorf("unexpected output %q", out.String())
+			}
+		})
+	}
+}
+
+func TestParseCipherSuites(t *testing.T) {
+	tt := []struct {
+		name        string
+		s           string
+		want        []uint16
+		errExpected bool
+	}{
+		{
+			name: "commas",
+			s:    "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256",
+			want: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256},
+		},
+		{
+			name: "colons",
+			s:    "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256:TLS_RSA_WITH_AES_128_CBC_SHA",
+			want: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, tls.TLS_RSA_WITH_AES_128_CBC_SHA},
+		},
+		{
+			name:        "unknown",
+			s:           "ECDHE-RSA-AES128-GCM-SHA256",
+			errExpected: true,
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseCipherSuites(tc.s)
+			if (err != nil) != tc.errExpected {
+				t.Fatalf("unexpected error status: %v", err)
+			}
+			if !tc.errExpected && !slices.Equal(got, tc.want) {
+				t.Errorf("got %v, want %v", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestClientCert(t *testing.T) {
+	ca, err := os.ReadFile("examples/ca.pem")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello "+r.TLS.PeerCertificates[0].Subject.CommonName)
+	}))
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: pool}
+	srv.StartTLS()
+	defer srv.Close()
+
+	promptPassword = func(string) (string, error) { return "secret", nil }
+	defer func() { promptPassword = readPassword }()
+	tt := []struct {
+		name            string
+		opts            Options
+		wantContains    string
+		wantErrContains string
+	}{
+		{
+			name: "certificate and key files",
+			opts: Options{Cert: "examples/client.pem", CertKey: "examples/client.key"},
+		},
+		{
+			name: "combined file",
+			opts: Options{Cert: "examples/client-combined.pem"},
+		},
+		{
+			name: "encrypted PKCS #8 key",
+			opts: Options{Cert: "examples/client.pem", CertKey: "examples/client-enc.key", CertKeyPass: "secret"},
+		},
+		{
+			name: "encrypted legacy key",
+			opts: Options{Cert: "examples/client.pem", CertKey: "examples/client-legacy.key", CertKeyPass: "secret"},
+		},
+		{
+			name: "passphrase prompt",
+			opts: Options{Cert: "examples/client.pem", CertKey: "examples/client-enc.key"},
+		},
+		{
+			name:            "wrong passphrase",
+			opts:            Options{Cert: "examples/client.pem", CertKey: "examples/client-enc.key", CertKeyPass: "nope"},
+			wantErrContains: "incorrect passphrase",
+		},
+		{
+			name:            "wrong passphrase legacy key",
+			opts:            Options{Cert: "examples/client.pem", CertKey: "examples/client-legacy.key", CertKeyPass: "nope"},
+			wantErrContains: "incorrect passphrase",
+		},
+		{
+			name:            "missing key",
+			opts:            Options{Cert: "examples/client.pem"},
+			wantErrContains: "no private key found",
+		},
+		{
+			name:            "missing certificate",
+			opts:            Options{Cert: "examples/missing.pem"},
+			wantErrContains: "cannot read the client certificate",
+		},
+		{
+			name:            "no client certificate",
+			opts:            Options{},
+			wantErrContains: "certificate required",
+		},
+		{
+			name:         "verbose",
+			opts:         Options{Cert: "examples/client-combined.pem", Verbose: true},
+			wantContains: "Client certificate:\n    Subject: CN=ihttp client\n    Issuer: CN=iHTTP Test CA\n",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.opts.Verify = "no"
+			out, err := NewOutput(req, nil, tc.opts)
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("\ngot\t%v\nwant\t%#q", err, tc.wantErrContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasSuffix(out.String(), "\nhello ihttp client") {
+				t.Errorf("unexpected output %q", out.String())
+			}
+			if !strings.Contains(out.String(), tc.wantContains) {
+				t.Errorf("\ngot\t%q\nwant\t%q", out.String(), tc.wantContains)
+			}
+		})
+	}
+}
+
+// newTestCert return a self-signed certificate for localhost and 127.0.0.1
+// that expires after d.
+func newTestCert(t *testing.T, d time.Duration) tls.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(42),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(d),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestPrintTLS(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	srv.TLS = &tls.Config{Certificates: []tls.Certificate{newTestCert(t, 5*24*time.Hour+time.Hour)}}
+	srv.StartTLS()
+	defer srv.Close()
+	tt := []struct {
+		name            string
+		opts            Options
+		wantContains    []string
+		wantNotContains []string
+	}{
+		{
+			name: "print TLS",
+			opts: Options{PrintTLS: true, ExpiryWarning: 30},
+			wantContains: []string{
+				"TLS connection:\n    Version: TLS 1.3\n",
+				"    ALPN protocol: http/1.1\n",
+				"Certificate 1/1:\n    Subject: CN=localhost\n    SANs: DNS:localhost, IP:127.0.0.1\n    Issuer: CN=localhost\n    Serial: 42\n",
+				"Warning: certificate 1 (CN=localhost) expires in 5 days",
+			},
+		},
+		{
+			name:            "expiry warning disabled",
+			opts:            Options{PrintTLS: true},
+			wantContains:    []string{"TLS connection:\n"},
+			wantNotContains: []string{"Warning:"},
+		},
+		{
+			name:            "expiry not within the warning days",
+			opts:            Options{PrintTLS: true, ExpiryWarning: 3},
+			wantContains:    []string{"TLS connection:\n"},
+			wantNotContains: []string{"Warning:"},
+		},
+		{
+			name:            "without print TLS",
+			opts:            Options{ExpiryWarning: 30},
+			wantNotContains: []string{"TLS connection:", "Warning:"},
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tc.opts.Verify = "no"
+			out, err := NewOutput(req, nil, tc.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tc.wantContains {
+				if !strings.Contains(out.String(), s) {
+					t.Errorf("\ngot\t%q\nwant\t%q", out.String(), s)
+				}
+			}
+			for _, s := range tc.wantNotContains {
+				if strings.Contains(out.String(), s) {
+					t.Errorf("unexpected %q in %q", s, out.String())
+				}
+			}
+		})
+	}
+}
+
+func TestTLSKeyLog(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "keys.log")
+	for range 2 {
+		req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := NewOutput(req, nil, Options{Verify: "no", TLSKeyLog: path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(b), "CLIENT_TRAFFIC_SECRET_0 "); n != 2 {
+		t.Errorf("want the secrets of 2 connections appended, got %d in %q", n, b)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0o600 {
+		t.Errorf("want permissions 0600, got %v", fi.Mode().Perm())
+	}
+
+	req, err := http.NewRequest(http.MethodGet, srv.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewOutput(req, nil, Options{Verify: "no", TLSKeyLog: filepath.Join(t.TempDir(), "missing", "keys.log")})
+	if err == nil || !strings.Contains(err.Error(), "cannot open the TLS key log file") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestPins(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello")
+	}))
+	defer srv.Close()
+	ca := writeCertPEM(t, srv)
+	sum := sha256.Sum256(srv.Certificate().RawSubjectPublicKeyInfo)
+	pin := "sha256//" + base64.StdEncoding.EncodeToString(sum[:])
+	other := "sha256//" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	// A server with an unrelated certificate, which appends the pinned one to
+	// its chain.
+	leaf := newTestCert(t, time.Hour)
+	leaf.Certificate = append(leaf.Certificate, srv.Certificate().Raw)
+	mitm := httptest.NewUnstartedServer(srv.Config.Handler)
+	mitm.TLS = &tls.Config{Certificates: []tls.Certificate{leaf}}
+	mitm.StartTLS()
+	defer mitm.Close()
+	mitmCA := writeCertPEM(t, mitm)
+	mitmSum := sha256.Sum256(mitm.Certificate().RawSubjectPublicKeyInfo)
+	mitmPin := "sha256//" + base64.StdEncoding.EncodeToString(mitmSum[:])
+	tt := []struct {
+		name            string
+		url             string
+		opts            Options
+		wantPinErr      bool
+		wantPins        []string
+		wantErrContains string
+	}{
+		{
+			name: "matching pin",
+			opts: Options{Verify: ca, Pins: []string{pin}},
+		},
+		{
+			name: "one of several pins",
+			opts: Options{Verify: ca, Pins: []string{other, pin}},
+		},
+		{
+			name:       "mismatch",
+			opts:       Options{Verify: ca, Pins: []string{other}},
+			wantPinErr: true,
+		},
+		{
+			name:       "mismatch without verification",
+			opts:       Options{Verify: "no", Pins: []string{other}},
+			wantPinErr: true,
+		},
+		{
+			name:       "pinned certificate appended to the chain",
+			url:        mitm.URL,
+			opts:       Options{Verify: mitmCA, Pins: []string{pin}},
+			wantPinErr: true,
+			wantPins:   []string{mitmPin},
+		},
+		{
+			name:       "pinned certificate appended without verification",
+			url:        mitm.URL,
+			opts:       Options{Verify: "no", Pins: []string{pin}},
+			wantPinErr: true,
+			wantPins:   []string{mitmPin},
+		},
+		{
+			name:            "missing hash algorithm",
+			opts:            Options{Verify: ca, Pins: []string{strings.TrimPrefix(pin, "sha256//")}},
+			wantErrContains: "invalid -pin",
+		},
+		{
+			name:            "invalid hash",
+			opts:            Options{Verify: ca, Pins: []string{"sha256//bm9wZQ=="}},
+			wantErrContains: "not a base64-encoded SHA-256 hash",
+		},
+	}
+	for _, tc := range tt {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.url == "" {
+				tc.url = srv.URL
+			}
+			if tc.wantPins == nil {
+				tc.wantPins = []string{pin}
+			}
+			req, err := http.NewRequest(http.MethodGet, tc.url, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = NewOutput(req, nil, tc.opts)
+			var pinErr *PinError
+			if errors.As(err, &pinErr) != tc.wantPinErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+			if tc.wantPinErr {
+				if !slices.Equal(pinErr.Pins, tc.wantPins) {
+					t.Errorf("\ngot\t%v\nwant\t%v", pinErr.Pins, tc.wantPins)
+				}
+
+				// The server of the test is at 127.0.0.1, without a server name.
+				if want := "public key pinning failed for 127.0.0.1:"; !strings.Contains(err.Error(), want) {
+					t.Errorf("\ngot\t%v\nwant\t%#q", err, want)
+				}
+				return
+			}
+			if tc.wantErrContains != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.wantErrContains) {
+					t.Fatalf("\ngot\t%v\nwant\t%#q", err, tc.wantErrContains)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}